@@ -37,10 +37,10 @@ func runController(logger *zap.Logger, port int, schedulerUrl, psUrl string) {
 
 }
 
-// Run the scheduler
-func runScheduler(logger *zap.Logger, port int, psUrl string) {
-	scheduler.Start(logger, port, psUrl)
-	logger.Fatal("Scheduler exited")
+// Run the scheduler, which only returns once it is shut down
+func runScheduler(logger *zap.Logger, port int, psUrl string, opts scheduler.Options) {
+	scheduler.Start(logger, port, psUrl, opts)
+	logger.Info("Scheduler shut down")
 }
 
 // Run the parameter server
@@ -134,8 +134,62 @@ Options:
 
 	// Run scheduler if it is the passed argument
 	if args["--schedulerPort"] != nil {
+		// the maximum number of functions running at the same
+		// time, by default there is no limit
+		var opts scheduler.Options
+		if b := os.Getenv("FUNCTION_BUDGET"); len(b) != 0 {
+			opts.FunctionBudget, err = strconv.Atoi(b)
+			if err != nil {
+				logger.Fatal("could not parse env variable for the function budget", zap.Error(err))
+			}
+		}
+
+		// the maximum parallelism of a single job, by default there is no limit
+		if m := os.Getenv("MAX_PARALLELISM"); len(m) != 0 {
+			opts.MaxParallelism, err = strconv.Atoi(m)
+			if err != nil {
+				logger.Fatal("could not parse env variable for the max parallelism", zap.Error(err))
+			}
+		}
+
+		// the weights of the teams sharing the budget, i.e. vision=2,nlp=1
+		opts.TeamShares, err = scheduler.ParseTeamShares(os.Getenv("TEAM_SHARES"))
+		if err != nil {
+			logger.Fatal("could not parse env variable for the team shares", zap.Error(err))
+		}
+
+		// where the state of the tasks is kept across restarts (mongo or memory),
+		// the scheduler still starts with the memory store if mongo is not available
+		switch store := os.Getenv("SCHEDULER_STORE"); store {
+		case "", "mongo":
+			opts.Store, err = scheduler.MakeMongoStore()
+			if err != nil {
+				logger.Warn("could not create the scheduler store, keeping the tasks in memory", zap.Error(err))
+				opts.Store = scheduler.MakeMemoryStore()
+			}
+		case "memory":
+			opts.Store = scheduler.MakeMemoryStore()
+		default:
+			logger.Fatal("unknown scheduler store", zap.String("store", store))
+		}
+
+		// the default scheduling policy and the thresholds of the throughput policy
+		opts.Policy = os.Getenv("SCHEDULER_POLICY")
+		for env, threshold := range map[string]*float64{
+			"THROUGHPUT_SCALE_UP":   &opts.ScaleUpThreshold,
+			"THROUGHPUT_SCALE_DOWN": &opts.ScaleDownThreshold,
+		} {
+			if t := os.Getenv(env); len(t) != 0 {
+				*threshold, err = strconv.ParseFloat(t, 64)
+				if err != nil {
+					logger.Fatal("could not parse env variable for the throughput thresholds", zap.Error(err))
+				}
+			}
+		}
+
 		port := getPort(logger, args["--schedulerPort"])
-		runScheduler(logger, port, psUrl)
+		runScheduler(logger, port, psUrl, opts)
+		return
 	}
 
 	// Run a new train job
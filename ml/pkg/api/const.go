@@ -15,6 +15,105 @@ const (
 
 const DefaultParallelism = 5
 
+// Aggregation rules of the custom metrics returned by the functions,
+// mean averages the values of the functions without weighting them
+const (
+	AggregationMean = "mean"
+	AggregationSum  = "sum"
+	AggregationMax  = "max"
+)
+
+// Policies used to adapt K during the training
+const (
+	AdaptiveKStatic     = "static"
+	AdaptiveKSchedule   = "schedule"
+	AdaptiveKDivergence = "divergence"
+)
+
+// Scheduling policies that choose the parallelism of the jobs
+const (
+	PolicyStatic      = "static"
+	PolicyThroughput  = "throughput"
+	PolicyConvergence = "convergence"
+	PolicyStepSearch  = "step_search"
+)
+
+// Scaling modes applied when the parallelism of a job changes. With
+// constant batch the batch size of the functions is rescaled so the global
+// batch stays the same, with linear lr the learning rate is scaled linearly
+// with the parallelism
+const (
+	ScalingNone          = "none"
+	ScalingConstantBatch = "constant_batch"
+	ScalingLinearLr      = "linear_lr"
+)
+
+// Strategies, goals and statuses of the sweeps and their trials
+const (
+	SweepGrid   = "grid"
+	SweepRandom = "random"
+	SweepFolds  = "folds"
+
+	GoalMaximize = "maximize"
+	GoalMinimize = "minimize"
+
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusStopped   = "stopped"
+	StatusPruned    = "pruned"
+
+	PruningHalving   = "halving"
+	PruningHyperband = "hyperband"
+)
+
+// Types of the events saved in the history and the timeline of a job
+const (
+	EventHyperparameters = "hyperparameters"
+
+	EventTaskReceived  = "task_received"
+	EventInitDone      = "init_done"
+	EventEpochStart    = "epoch_start"
+	EventEpochEnd      = "epoch_end"
+	EventMerge         = "merge"
+	EventParallelism   = "parallelism"
+	EventFunctionError = "function_error"
+	EventValidation    = "validation"
+	EventEvaluation    = "evaluation"
+	EventStopRequested = "stop_requested"
+	EventPause         = "pause"
+	EventResume        = "resume"
+	EventFinished      = "finished"
+	EventPreemption    = "preemption"
+)
+
+// Priority classes of the jobs and the actions taken
+// on the jobs preempted by others of higher priority
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+
+	PreemptScaleDown = "scale_down"
+	PreemptPause     = "pause"
+)
+
+// Phases of the lifecycle of a train job
+const (
+	PhaseQueued       JobPhase = "Queued"
+	PhasePending      JobPhase = "Pending"
+	PhaseInitializing JobPhase = "Initializing"
+	PhaseTraining     JobPhase = "Training"
+	PhaseValidating   JobPhase = "Validating"
+	PhaseMerging      JobPhase = "Merging"
+	PhasePaused       JobPhase = "Paused"
+	PhaseStopping     JobPhase = "Stopping"
+	PhaseSucceeded    JobPhase = "Succeeded"
+	PhaseFailed       JobPhase = "Failed"
+	PhaseStopped      JobPhase = "Stopped"
+)
+
 // Debug
 const (
 	MongoUrlDebug            = "mongodb://192.168.99.101:30074"
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -18,6 +20,16 @@ type (
 		LearningRate float32      `json:"lr"`
 		FunctionName string       `json:"function_name"`
 		Options      TrainOptions `json:"options,omitempty"`
+
+		// Priority is the priority class of the job (low, normal or high).
+		// Jobs of higher priority are admitted first and can preempt the
+		// running jobs of lower priority when there are not enough functions
+		Priority string `json:"priority,omitempty"`
+
+		// Owner and Team identify who submitted the job. The functions are
+		// shared fairly among the teams, or among the owners of jobs without a team
+		Owner string `json:"owner,omitempty"`
+		Team  string `json:"team,omitempty"`
 	}
 
 	// TrainOptions allows users to define extra configurations for the
@@ -26,11 +38,83 @@ type (
 		DefaultParallelism int  `json:"default_parallelism"`
 		StaticParallelism  bool `json:"static_parallelism"`
 		ValidateEvery      int  `json:"validate_every"`
+		// MinParallelism is the minimum number of functions the job
+		// needs, it waits in the queue until they are available
+		MinParallelism int `json:"min_parallelism,omitempty"`
+		// MaxParallelism is the maximum number of functions the scheduler
+		// gives to the job, zero meaning only the limit of the scheduler
+		MaxParallelism int `json:"max_parallelism,omitempty"`
+		// Policy is the scheduling policy that chooses the parallelism
+		// of the job, by default the one configured in the scheduler
+		Policy string `json:"policy,omitempty"`
 		// K is the parameter of the K-avg algorithm, after how many
 		// updates we sync with the PS
 		K int `json:"k"`
 		// GoalAccuracy accuracy objective, after which we'll stop the training
 		GoalAccuracy float64 `json:"goal_accuracy"`
+		// MetricAggregation sets how the custom metrics returned by the
+		// functions are aggregated (mean, sum or max), by default
+		// the mean weighted by the length returned by each function
+		MetricAggregation map[string]string `json:"metric_aggregation,omitempty"`
+		// AdaptiveK changes K between epochs, if not set K is static
+		AdaptiveK *AdaptiveKOptions `json:"adaptive_k,omitempty"`
+		// Scaling sets how the batch size or the learning rate are
+		// rescaled when the parallelism of the job changes
+		Scaling string `json:"scaling,omitempty"`
+		// Folds runs a k-fold cross validation with this number of folds,
+		// launching a job per fold. Fold is the fold held out by each
+		// of those jobs and is set by the controller
+		Folds int `json:"folds,omitempty"`
+		Fold  int `json:"fold,omitempty"`
+		// Seed makes the training reproducible. The functions get seeds
+		// derived from it and the models are merged in a fixed order
+		Seed *int64 `json:"seed,omitempty"`
+		// ShuffleShards changes the documents of the dataset
+		// assigned to each function in every epoch
+		ShuffleShards bool `json:"shuffle_shards,omitempty"`
+		// FinalEvaluation evaluates the final model on the test set once
+		// the training finishes, saving a per-class report in the history
+		FinalEvaluation bool `json:"final_evaluation,omitempty"`
+		// ValidationFraction validates on a random sample of this fraction
+		// of the test set, ValidationParallelism sets the number of validation
+		// functions and ValidateEveryRounds validates after every N merge rounds
+		// during the epochs. The final validation always uses the whole test set
+		ValidationFraction    float64 `json:"validation_fraction,omitempty"`
+		ValidationParallelism int     `json:"validation_parallelism,omitempty"`
+		ValidateEveryRounds   int     `json:"validate_every_rounds,omitempty"`
+	}
+
+	// Shard is a range of documents of the train collection of a dataset,
+	// from Start to End not included. Each document holds a subset of the samples
+	Shard struct {
+		Start int `json:"start"`
+		End   int `json:"end"`
+	}
+
+	// AdaptiveKOptions configures how K is changed during the training.
+	//
+	// With the schedule policy K is multiplied by Factor every Every epochs.
+	// With the divergence policy K is divided by Factor when the divergence
+	// between the models of the functions goes over Threshold, and multiplied by it
+	// when the divergence falls under half the threshold.
+	// K is always kept between MinK and MaxK
+	AdaptiveKOptions struct {
+		Policy    string  `json:"policy"`
+		MinK      int     `json:"min_k"`
+		MaxK      int     `json:"max_k"`
+		Factor    float64 `json:"factor"`
+		Every     int     `json:"every,omitempty"`
+		Threshold float64 `json:"threshold,omitempty"`
+	}
+
+	// HyperparameterUpdate is sent to change the settings of a running
+	// train job, only the fields set are applied in the next epoch
+	HyperparameterUpdate struct {
+		LearningRate  *float32 `json:"lr,omitempty"`
+		K             *int     `json:"k,omitempty"`
+		BatchSize     *int     `json:"batch_size,omitempty"`
+		ValidateEvery *int     `json:"validate_every,omitempty"`
+		GoalAccuracy  *float64 `json:"goal_accuracy,omitempty"`
 	}
 
 	// InferRequest is sent when wanting to get a result back from a trained network
@@ -68,8 +152,24 @@ type (
 	JobState struct {
 		Parallelism int     `json:"parallelism"`
 		ElapsedTime float64 `json:"elapsed_time"`
+
+		// Loss is the train loss of the last epoch
+		Loss float64 `json:"loss,omitempty"`
+
+		// Phase is the point of the lifecycle the job is at, along
+		// with the epoch and the time of the last transition
+		Phase          JobPhase  `json:"phase,omitempty"`
+		Epoch          int       `json:"epoch,omitempty"`
+		LastTransition time.Time `json:"last_transition"`
+
+		// QueuePosition is the position of a queued job in the
+		// queue of the scheduler, starting at 1
+		QueuePosition int `json:"queue_position,omitempty"`
 	}
 
+	// JobPhase is each of the stages of the lifecycle of a train job
+	JobPhase string
+
 	// JobHistory saves the intermediate results from the training process
 	// epoch to epoch
 	JobHistory struct {
@@ -78,6 +178,96 @@ type (
 		TrainLoss      []float64 `json:"train_loss"`
 		Parallelism    []float64 `json:"parallelism"`
 		EpochDuration  []float64 `json:"epoch_duration"`
+
+		// ValidationEpochs holds the epoch in which each
+		// of the validation results was taken
+		ValidationEpochs []int `json:"validation_epochs,omitempty"`
+
+		// Functions holds the per-function breakdown of every epoch
+		Functions []FunctionRecord `json:"functions,omitempty"`
+
+		// IterationLoss holds the loss reported by the functions
+		// in each of the merge rounds of the epochs
+		IterationLoss []IterationMetric `json:"iteration_loss,omitempty"`
+
+		// TrainMetrics and ValidationMetrics hold the series of
+		// the custom metrics returned by the functions
+		TrainMetrics      map[string][]float64 `json:"train_metrics,omitempty"`
+		ValidationMetrics map[string][]float64 `json:"validation_metrics,omitempty"`
+
+		// K and Divergence hold the K used in each epoch and the
+		// average divergence between the models of the functions
+		K          []float64 `json:"k,omitempty"`
+		Divergence []float64 `json:"divergence,omitempty"`
+
+		// BatchSize and LearningRate hold the effective values
+		// used by the functions in each epoch
+		BatchSize    []float64 `json:"batch_size,omitempty"`
+		LearningRate []float64 `json:"learning_rate,omitempty"`
+
+		// Coverage holds the fraction of the documents of the
+		// train set that the functions trained on in each epoch
+		Coverage []float64 `json:"coverage,omitempty"`
+
+		// Events holds the changes made to the job during the training
+		Events []HistoryEvent `json:"events,omitempty"`
+	}
+
+	// HistoryEvent records a change in the settings of the job
+	// and the epoch from which it was applied
+	HistoryEvent struct {
+		Epoch           int                   `json:"epoch"`
+		Timestamp       time.Time             `json:"timestamp"`
+		Type            string                `json:"type"`
+		Message         string                `json:"message,omitempty"`
+		Hyperparameters *HyperparameterUpdate `json:"hyperparameters,omitempty"`
+	}
+
+	// Preemption is sent to a job whose functions are taken by a job of
+	// higher priority. The job is either scaled down to its minimum
+	// parallelism or paused at the end of its current epoch
+	Preemption struct {
+		Action      string `json:"action"`
+		Parallelism int    `json:"parallelism,omitempty"`
+		JobId       string `json:"job_id"`
+		Priority    string `json:"priority"`
+	}
+
+	// JobEvent is an entry in the timeline of a train job, recorded
+	// when something relevant for debugging the job happens
+	JobEvent struct {
+		JobId     string                 `bson:"job_id" json:"job_id"`
+		Timestamp time.Time              `json:"timestamp"`
+		Epoch     int                    `json:"epoch"`
+		Type      string                 `json:"type"`
+		Message   string                 `json:"message,omitempty"`
+		Details   map[string]interface{} `json:"details,omitempty"`
+	}
+
+	// FunctionRecord saves the results of a single train function
+	// during an epoch, so slow or diverging functions can be spotted
+	FunctionRecord struct {
+		Epoch    int     `json:"epoch"`
+		FuncId   int     `json:"func_id"`
+		Duration float64 `json:"duration"`
+		Syncs    int     `json:"syncs"`
+		Loss     float64 `json:"loss"`
+		Samples  int     `json:"samples"`
+		Error    string  `json:"error,omitempty"`
+
+		// Shards are the documents assigned to the function, and Recovery
+		// is set if it retrained the shards of failed functions
+		Shards   []Shard `json:"shards,omitempty"`
+		Recovery bool    `json:"recovery,omitempty"`
+	}
+
+	// IterationMetric is the running loss of the functions in a merge
+	// round, averaged by the number of samples of each function
+	IterationMetric struct {
+		Epoch   int     `json:"epoch"`
+		Round   int     `json:"round"`
+		Loss    float64 `json:"loss"`
+		Samples int     `json:"samples"`
 	}
 
 	// MetricUpdate is received by the parameter server from the train jobs
@@ -88,6 +278,10 @@ type (
 		TrainLoss      float64 `json:"train_loss"`
 		Parallelism    float64 `json:"parallelism"`
 		EpochDuration  float64 `json:"epoch_duration"`
+		IterationLoss  float64 `json:"iteration_loss"`
+
+		TrainMetrics      map[string]float64 `json:"train_metrics,omitempty"`
+		ValidationMetrics map[string]float64 `json:"validation_metrics,omitempty"`
 	}
 
 	// A single datapoint plus label
@@ -101,6 +295,118 @@ type (
 		Id   string       `bson:"_id" json:"id"`
 		Task TrainRequest `json:"task"`
 		Data JobHistory   `json:"data,omitempty"`
+
+		// Status is running while the job trains and is set
+		// to the final status of the job once it finishes
+		Status string `json:"status,omitempty"`
+
+		// CrossValidation is set in the summary of a cross validation
+		// run, which is saved with the id of the run
+		CrossValidation *CrossValidationSummary `json:"cross_validation,omitempty"`
+
+		// Report is the evaluation of the final model on the
+		// test set, set if the final evaluation was requested
+		Report *EvaluationReport `json:"report,omitempty"`
+	}
+
+	// EvaluationReport holds the confusion matrix of the final model on the
+	// test set, where Confusion[i][j] is the number of samples of class i
+	// predicted as class j, along with the metrics of each of the classes.
+	// Accuracy is a percentage, like the accuracy in the history of the job
+	EvaluationReport struct {
+		Samples   int            `json:"samples"`
+		Accuracy  float64        `json:"accuracy"`
+		Confusion [][]int        `json:"confusion"`
+		Classes   []ClassMetrics `json:"classes"`
+		MacroF1   float64        `json:"macro_f1"`
+	}
+
+	// ClassMetrics holds the precision, recall and F1 score of a class.
+	// Support is the number of samples of the class in the test set
+	ClassMetrics struct {
+		Class     int     `json:"class"`
+		Precision float64 `json:"precision"`
+		Recall    float64 `json:"recall"`
+		F1        float64 `json:"f1"`
+		Support   int     `json:"support"`
+	}
+
+	// CrossValidationSummary aggregates the final validation
+	// results of the jobs of a cross validation run
+	CrossValidationSummary struct {
+		Folds        []FoldResult `json:"folds"`
+		MeanAccuracy float64      `json:"mean_accuracy"`
+		StdAccuracy  float64      `json:"std_accuracy"`
+		MeanLoss     float64      `json:"mean_loss"`
+		StdLoss      float64      `json:"std_loss"`
+	}
+
+	// FoldResult is the result of the job trained on a single fold
+	FoldResult struct {
+		Fold     int     `json:"fold"`
+		JobId    string  `json:"job_id"`
+		Status   string  `json:"status"`
+		Accuracy float64 `json:"accuracy"`
+		Loss     float64 `json:"loss"`
+	}
+
+	// SweepRequest describes a hyperparameter sweep. The trials are
+	// built by setting the parameters sampled from the search space in the
+	// base train request and are run at most Concurrency at a time
+	SweepRequest struct {
+		Name        string                    `json:"name"`
+		Base        TrainRequest              `json:"base"`
+		Strategy    string                    `json:"strategy"`
+		Trials      int                       `json:"trials,omitempty"`
+		Concurrency int                       `json:"concurrency"`
+		Metric      string                    `json:"metric"`
+		Goal        string                    `json:"goal"`
+		Parameters  map[string]SweepParameter `json:"parameters"`
+		Pruning     *PruningOptions           `json:"pruning,omitempty"`
+	}
+
+	// PruningOptions configure the early termination of the trials of a sweep.
+	// Trials are compared at rung epochs, the first at MinEpochs and the next
+	// ones Eta times further, and only the best 1/Eta of them keep training.
+	// Hyperband spreads the trials in brackets that start at different rungs
+	PruningOptions struct {
+		Policy    string `json:"policy"`
+		MinEpochs int    `json:"min_epochs"`
+		Eta       int    `json:"eta"`
+	}
+
+	// SweepParameter is the search space of a single hyperparameter. The
+	// grid strategy uses the values, while the random strategy samples from
+	// the values or, if they are not set, from the range between Min and Max
+	SweepParameter struct {
+		Values []float64 `json:"values,omitempty"`
+		Min    float64   `json:"min,omitempty"`
+		Max    float64   `json:"max,omitempty"`
+		Log    bool      `json:"log,omitempty"`
+	}
+
+	// Sweep is the state of a sweep saved in the database
+	Sweep struct {
+		Id        string       `bson:"_id" json:"id"`
+		Request   SweepRequest `json:"request"`
+		Status    string       `json:"status"`
+		Trials    []Trial      `json:"trials"`
+		BestTrial string       `json:"best_trial,omitempty"`
+		Created   time.Time    `json:"created"`
+	}
+
+	// Trial is each of the train jobs launched by a sweep
+	Trial struct {
+		JobId      string             `json:"job_id,omitempty"`
+		Parameters map[string]float64 `json:"parameters"`
+		Status     string             `json:"status"`
+		Metric     *float64           `json:"metric,omitempty"`
+		Error      string             `json:"error,omitempty"`
+
+		// Bracket and Rungs hold the bracket of the trial when the
+		// sweep is pruned and the value of the metric at each rung reached
+		Bracket int       `json:"bracket,omitempty"`
+		Rungs   []float64 `json:"rungs,omitempty"`
 	}
 
 	// DatasetSummary describes the contents a kubeml dataset
@@ -28,6 +28,16 @@ func (c *Controller) getHandler() http.Handler {
 	// get current tasks
 	r.HandleFunc("/tasks", c.listTasks).Methods("GET")
 	r.HandleFunc("/tasks/{jobId}", c.stopTask).Methods("DELETE")
+	r.HandleFunc("/tasks/{jobId}", c.updateTask).Methods("PATCH")
+	r.HandleFunc("/tasks/{jobId}/pause", c.pauseTask).Methods("POST")
+	r.HandleFunc("/tasks/{jobId}/resume", c.resumeTask).Methods("POST")
+	r.HandleFunc("/tasks/{jobId}/events", c.getTaskEvents).Methods("GET")
+
+	// hyperparameter sweeps
+	r.HandleFunc("/sweeps", c.createSweep).Methods("POST")
+	r.HandleFunc("/sweeps", c.listSweeps).Methods("GET")
+	r.HandleFunc("/sweeps/{sweepId}", c.getSweep).Methods("GET")
+	r.HandleFunc("/sweeps/{sweepId}", c.stopSweep).Methods("DELETE")
 
 	// history
 	r.HandleFunc("/history/{taskId}", c.getHistory).Methods("GET")
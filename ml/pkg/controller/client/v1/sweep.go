@@ -0,0 +1,132 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	kerror "github.com/diegostock12/kubeml/ml/pkg/error"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+)
+
+type (
+	SweepGetter interface {
+		Sweeps() SweepInterface
+	}
+
+	SweepInterface interface {
+		Create(req *api.SweepRequest) (string, error)
+		Get(sweepId string) (*api.Sweep, error)
+		List() ([]api.Sweep, error)
+		Stop(sweepId string) error
+	}
+
+	sweeps struct {
+		controllerUrl string
+		httpClient    *http.Client
+	}
+)
+
+func newSweeps(c *V1) SweepInterface {
+	return &sweeps{
+		controllerUrl: c.controllerUrl,
+		httpClient:    c.httpClient,
+	}
+}
+
+func (s *sweeps) Create(req *api.SweepRequest) (string, error) {
+	url := s.controllerUrl + "/sweeps"
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal sweep request")
+	}
+
+	resp, err := s.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "could not perform sweep request")
+	}
+	defer resp.Body.Close()
+
+	if err = kerror.CheckHttpResponse(resp); err != nil {
+		return "", err
+	}
+
+	id, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse body")
+	}
+
+	return string(id), nil
+}
+
+func (s *sweeps) Get(sweepId string) (*api.Sweep, error) {
+	url := s.controllerUrl + "/sweeps/" + sweepId
+
+	resp, err := s.httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not perform sweep request")
+	}
+	defer resp.Body.Close()
+
+	if err = kerror.CheckHttpResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse body")
+	}
+
+	var sweep api.Sweep
+	err = json.Unmarshal(body, &sweep)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal sweep")
+	}
+
+	return &sweep, nil
+}
+
+func (s *sweeps) List() ([]api.Sweep, error) {
+	url := s.controllerUrl + "/sweeps"
+
+	resp, err := s.httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not perform sweep request")
+	}
+	defer resp.Body.Close()
+
+	if err = kerror.CheckHttpResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse body")
+	}
+
+	var sweeps []api.Sweep
+	err = json.Unmarshal(body, &sweeps)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal json")
+	}
+
+	return sweeps, nil
+}
+
+func (s *sweeps) Stop(sweepId string) error {
+	url := s.controllerUrl + "/sweeps/" + sweepId
+
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not create request body")
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not handle request")
+	}
+
+	return kerror.CheckHttpResponse(resp)
+}
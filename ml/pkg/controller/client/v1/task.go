@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/diegostock12/kubeml/ml/pkg/api"
 	"github.com/pkg/errors"
@@ -16,6 +17,10 @@ type (
 	TaskInterface interface {
 		List() ([]api.TrainTask, error)
 		Stop(id string) error
+		Pause(id string) error
+		Resume(id string) error
+		Update(id string, update api.HyperparameterUpdate) error
+		Events(id string) ([]api.JobEvent, error)
 	}
 
 	tasks struct {
@@ -80,3 +85,90 @@ func (t *tasks) Stop(id string) error {
 	return nil
 
 }
+
+func (t *tasks) Events(id string) ([]api.JobEvent, error) {
+	url := t.controllerUrl + "/tasks/" + id + "/events"
+
+	resp, err := t.httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not handle request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(body))
+	}
+
+	var events []api.JobEvent
+	err = json.Unmarshal(body, &events)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal events")
+	}
+
+	return events, nil
+}
+
+func (t *tasks) Pause(id string) error {
+	return t.sendCommand(id, "pause")
+}
+
+func (t *tasks) Resume(id string) error {
+	return t.sendCommand(id, "resume")
+}
+
+// sendCommand posts a command for the given task to the controller
+func (t *tasks) sendCommand(id, command string) error {
+	url := t.controllerUrl + "/tasks/" + id + "/" + command
+
+	resp, err := t.httpClient.Post(url, "text/plain", nil)
+	if err != nil {
+		return errors.Wrap(err, "could not handle request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+
+	return nil
+}
+
+func (t *tasks) Update(id string, update api.HyperparameterUpdate) error {
+	url := t.controllerUrl + "/tasks/" + id
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal update")
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create request body")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not handle request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+
+	return nil
+}
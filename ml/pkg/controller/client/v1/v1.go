@@ -7,6 +7,7 @@ type V1Interface interface {
 	DatasetsGetter
 	HistoryGetter
 	TaskGetter
+	SweepGetter
 }
 
 type V1 struct {
@@ -36,3 +37,7 @@ func (c *V1) Datasets() DatasetInterface {
 func (c *V1) Tasks() TaskInterface {
 	return newTasks(c)
 }
+
+func (c *V1) Sweeps() SweepInterface {
+	return newSweeps(c)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/diegostock12/kubeml/ml/pkg/api"
 	psClient "github.com/diegostock12/kubeml/ml/pkg/ps/client"
 	schedulerClient "github.com/diegostock12/kubeml/ml/pkg/scheduler/client"
+	"github.com/diegostock12/kubeml/ml/pkg/sweep"
 	"github.com/diegostock12/kubeml/ml/pkg/util"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -24,6 +25,7 @@ type (
 		scheduler   *schedulerClient.Client
 		ps          *psClient.Client
 		mongoClient *mongo.Client
+		sweeps      *sweep.Runner
 	}
 )
 
@@ -65,6 +67,13 @@ func Start(logger *zap.Logger, port int, schedulerUrl, psUrl string) {
 	}
 	c.mongoClient = client
 
+	// start the sweep runner and continue with
+	// the sweeps left running
+	c.sweeps = sweep.NewRunner(c.logger, c.scheduler, c.ps, client)
+	if err := c.sweeps.Resume(); err != nil {
+		c.logger.Error("Could not resume sweeps", zap.Error(err))
+	}
+
 	c.Serve(port)
 
 }
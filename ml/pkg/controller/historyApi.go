@@ -91,6 +91,13 @@ func (c *Controller) deleteHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// delete the timeline of the job along with its history
+	events := c.mongoClient.Database("kubeml").Collection("events")
+	_, err = events.DeleteMany(context.TODO(), bson.M{"job_id": taskId})
+	if err != nil {
+		c.logger.Warn("Could not delete the events of the job", zap.Error(err))
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -107,5 +114,10 @@ func (c *Controller) pruneHistories(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = c.mongoClient.Database("kubeml").Collection("events").Drop(context.TODO())
+	if err != nil {
+		c.logger.Warn("Could not delete events", zap.Error(err))
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
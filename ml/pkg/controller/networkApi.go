@@ -2,7 +2,10 @@ package controller
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
@@ -30,12 +33,33 @@ func (c *Controller) train(w http.ResponseWriter, r *http.Request) {
 
 	// TODO filter if the dataset exists before submitting
 
+	if err := validateAdaptiveK(req.Options.AdaptiveK); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// cross validation runs launch a job per fold
+	// and return the id of the run
+	if req.Options.Folds > 1 {
+		run, err := c.sweeps.CrossValidate(req)
+		if err != nil {
+			c.logger.Error("Could not start cross validation",
+				zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(run.Id))
+		return
+	}
+
 	// Forward the request to the scheduler
 	id, err := c.scheduler.SubmitTrainTask(req)
 	if err != nil {
 		c.logger.Error("Could not get job id",
 			zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -44,6 +68,38 @@ func (c *Controller) train(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(id))
 }
 
+// validateAdaptiveK checks the options of the adaptive K policy. The
+// factor must be bigger than one, since K is divided by it when the
+// divergence is high and a smaller factor would reverse the policy
+func validateAdaptiveK(opts *api.AdaptiveKOptions) error {
+	if opts == nil {
+		return nil
+	}
+
+	e := &multierror.Error{}
+	switch opts.Policy {
+	case api.AdaptiveKSchedule:
+		if opts.Every <= 0 {
+			e = multierror.Append(e, errors.New("adaptive K every should be a positive value"))
+		}
+	case api.AdaptiveKDivergence:
+		if opts.Threshold <= 0 {
+			e = multierror.Append(e, errors.New("adaptive K threshold should be bigger than zero"))
+		}
+	default:
+		e = multierror.Append(e, fmt.Errorf("unknown adaptive K policy \"%v\"", opts.Policy))
+	}
+
+	if opts.MinK <= 0 || (opts.MaxK > 0 && opts.MaxK < opts.MinK) {
+		e = multierror.Append(e, errors.New("adaptive K min should be positive and not bigger than the max"))
+	}
+	if opts.Factor <= 1 {
+		e = multierror.Append(e, errors.New("adaptive K factor should be bigger than one"))
+	}
+
+	return e.ErrorOrNil()
+}
+
 // infer gets an Inference request from the client
 // and simply sends the query to the scheduler
 func (c *Controller) infer(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"testing"
+)
+
+func TestValidateAdaptiveK(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  *api.AdaptiveKOptions
+		valid bool
+	}{
+		{name: "static", opts: nil, valid: true},
+		{
+			name:  "schedule",
+			opts:  &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 1, MaxK: 16, Factor: 2, Every: 2},
+			valid: true,
+		},
+		{
+			name:  "divergence",
+			opts:  &api.AdaptiveKOptions{Policy: api.AdaptiveKDivergence, MinK: 1, Factor: 1.5, Threshold: 0.1},
+			valid: true,
+		},
+		{name: "zero factor", opts: &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 1, Every: 2}},
+		{name: "factor under one", opts: &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 1, Factor: 0.5, Every: 2}},
+		{name: "factor of one", opts: &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 1, Factor: 1, Every: 2}},
+		{name: "no steps", opts: &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 1, Factor: 2}},
+		{name: "no threshold", opts: &api.AdaptiveKOptions{Policy: api.AdaptiveKDivergence, MinK: 1, Factor: 2}},
+		{name: "no min k", opts: &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, Factor: 2, Every: 2}},
+		{name: "max under min", opts: &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 4, MaxK: 2, Factor: 2, Every: 2}},
+		{name: "unknown policy", opts: &api.AdaptiveKOptions{Policy: "other", MinK: 1, Factor: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAdaptiveK(tt.opts)
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/diegostock12/kubeml/ml/pkg/sweep"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+)
+
+// createSweep starts a new hyperparameter sweep and returns its id
+func (c *Controller) createSweep(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.logger.Error("Could not read body", zap.Error(err))
+		http.Error(w, "Failed to read request", http.StatusInternalServerError)
+		return
+	}
+
+	var req api.SweepRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		c.logger.Error("Failed to parse the sweep request",
+			zap.Error(err),
+			zap.String("payload", string(body)))
+		http.Error(w, "Failed to decode the request", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateAdaptiveK(req.Base.Options.AdaptiveK); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sweep.ValidateRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, err := c.sweeps.Create(req)
+	if err != nil {
+		c.logger.Error("Could not create sweep", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(s.Id))
+}
+
+// listSweeps returns all the sweeps in the database
+func (c *Controller) listSweeps(w http.ResponseWriter, r *http.Request) {
+	sweeps, err := c.sweeps.List()
+	if err != nil {
+		c.logger.Error("Could not list sweeps", zap.Error(err))
+		http.Error(w, "Could not list sweeps", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(sweeps)
+	if err != nil {
+		c.logger.Error("Could not marshal sweeps", zap.Error(err))
+		http.Error(w, "error processing request", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// getSweep returns a sweep along with its trials
+func (c *Controller) getSweep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sweepId := vars["sweepId"]
+
+	sweep, err := c.sweeps.Get(sweepId)
+	if err != nil {
+		c.logger.Error("Could not find sweep", zap.Error(err))
+		http.Error(w, "Could not find sweep", http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.MarshalIndent(sweep, "", "  ")
+	if err != nil {
+		c.logger.Error("Could not marshal sweep", zap.Error(err))
+		http.Error(w, "Error marshaling request", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// stopSweep stops all the trials of a running sweep
+func (c *Controller) stopSweep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sweepId := vars["sweepId"]
+
+	err := c.sweeps.Stop(sweepId)
+	if err != nil {
+		c.logger.Error("Could not stop sweep", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,11 +1,54 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
 	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"net/http"
 )
 
+// getTaskEvents returns the timeline of a job sorted by time. The events
+// are kept in the database, so they are available after the job finishes
+func (c *Controller) getTaskEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	collection := c.mongoClient.Database("kubeml").Collection("events")
+	opts := options.Find().SetSort(bson.M{"timestamp": 1})
+	cursor, err := collection.Find(context.TODO(), bson.M{"job_id": jobId}, opts)
+	if err != nil {
+		c.logger.Error("Could not get events", zap.String("jobId", jobId), zap.Error(err))
+		http.Error(w, "Could not get events", http.StatusInternalServerError)
+		return
+	}
+
+	events := make([]api.JobEvent, 0)
+	err = cursor.All(context.TODO(), &events)
+	if err != nil {
+		c.logger.Error("could not extract events from cursor", zap.Error(err))
+		http.Error(w, "error processing request", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(events)
+	if err != nil {
+		c.logger.Error("Could not marshal events", zap.Error(err))
+		http.Error(w, "error processing request", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
 // listTasks gets the tasks from the ps and simply redirects them
 func (c *Controller) listTasks(w http.ResponseWriter, r *http.Request) {
 	taskBytes, err := c.ps.ListTasks()
@@ -15,6 +58,26 @@ func (c *Controller) listTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// add the tasks still waiting in the queue of the scheduler
+	queued, err := c.scheduler.Queue()
+	if err != nil {
+		c.logger.Warn("error getting queued tasks from the scheduler", zap.Error(err))
+	} else if len(queued) > 0 {
+		var tasks []api.TrainTask
+		if err := json.Unmarshal(taskBytes, &tasks); err != nil {
+			c.logger.Error("error unmarshalling tasks", zap.Error(err))
+			http.Error(w, "error getting tasks", http.StatusInternalServerError)
+			return
+		}
+
+		taskBytes, err = json.Marshal(append(tasks, queued...))
+		if err != nil {
+			c.logger.Error("error marshalling tasks", zap.Error(err))
+			http.Error(w, "error getting tasks", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(taskBytes)
@@ -24,6 +87,12 @@ func (c *Controller) stopTask(w http.ResponseWriter, r *http.Request)  {
 	vars := mux.Vars(r)
 	jobId := vars["jobId"]
 
+	// tasks still waiting to be admitted are only in the scheduler
+	if err := c.scheduler.CancelJob(jobId); err == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	err := c.ps.StopTask(jobId)
 	if err != nil {
 		c.logger.Error("Error stoping task",
@@ -34,3 +103,102 @@ func (c *Controller) stopTask(w http.ResponseWriter, r *http.Request)  {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// updateTask validates the new hyperparameters of a task and forwards them
+// to the parameter server so they are applied in the next epoch
+func (c *Controller) updateTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.logger.Error("Could not read body", zap.Error(err))
+		http.Error(w, "Failed to read request", http.StatusInternalServerError)
+		return
+	}
+
+	var update api.HyperparameterUpdate
+	err = json.Unmarshal(body, &update)
+	if err != nil {
+		c.logger.Error("Failed to parse the update request",
+			zap.Error(err),
+			zap.String("payload", string(body)))
+		http.Error(w, "Failed to decode the request", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateHyperparameters(update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.ps.UpdateHyperparameters(jobId, update)
+	if err != nil {
+		c.logger.Error("Error updating task",
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// validateHyperparameters checks that the update sets at
+// least one hyperparameter and that their values are valid
+func validateHyperparameters(update api.HyperparameterUpdate) error {
+	if update.LearningRate == nil && update.K == nil && update.BatchSize == nil &&
+		update.ValidateEvery == nil && update.GoalAccuracy == nil {
+		return errors.New("no hyperparameters to update")
+	}
+
+	e := &multierror.Error{}
+	if update.LearningRate != nil && *update.LearningRate <= 0 {
+		e = multierror.Append(e, errors.New("learning rate should be bigger than zero"))
+	}
+	if update.K != nil && *update.K != -1 && *update.K <= 0 {
+		e = multierror.Append(e, errors.New("K should be a positive value or -1"))
+	}
+	if update.BatchSize != nil && *update.BatchSize <= 0 {
+		e = multierror.Append(e, errors.New("batch size should be a positive value"))
+	}
+	if update.ValidateEvery != nil && *update.ValidateEvery < 0 {
+		e = multierror.Append(e, errors.New("validate every should not be negative"))
+	}
+	if update.GoalAccuracy != nil && (*update.GoalAccuracy <= 0 || *update.GoalAccuracy > 100) {
+		e = multierror.Append(e, errors.New("goal accuracy should be between 0 and 100"))
+	}
+
+	return e.ErrorOrNil()
+}
+
+// pauseTask makes the task wait after its current epoch until resumed
+func (c *Controller) pauseTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	err := c.ps.PauseTask(jobId)
+	if err != nil {
+		c.logger.Error("Error pausing task",
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// resumeTask lets a paused task continue training
+func (c *Controller) resumeTask(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	err := c.ps.ResumeTask(jobId)
+	if err != nil {
+		c.logger.Error("Error resuming task",
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
 	kubemlClient "github.com/diegostock12/kubeml/ml/pkg/controller/client"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -13,7 +14,9 @@ import (
 )
 
 var (
-	taskId string
+	taskId        string
+	showFunctions bool
+	showReport    bool
 
 	historyCmd = &cobra.Command{
 		Use:   "history",
@@ -58,6 +61,24 @@ func getHistory(_ *cobra.Command, _ []string) error {
 		return err
 	}
 
+	if showFunctions {
+		printFunctionRecords(history)
+		return nil
+	}
+
+	if showReport {
+		if history.Report == nil {
+			return errors.New("the task has no evaluation report, train it with --final-evaluation")
+		}
+		printReport(history.Report)
+		return nil
+	}
+
+	if history.CrossValidation != nil {
+		printCrossValidation(history.CrossValidation)
+		return nil
+	}
+
 	out, err := json.MarshalIndent(history, "", "  ")
 	if err != nil {
 		return errors.Wrap(err, "could not marshal json")
@@ -67,6 +88,85 @@ func getHistory(_ *cobra.Command, _ []string) error {
 	return nil
 }
 
+// printFunctionRecords prints the per-function breakdown of each
+// epoch of the training history
+func printFunctionRecords(history *api.History) {
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", "EPOCH", "FUNCTION", "DURATION (s)", "SYNCS", "LOSS", "SAMPLES", "SHARDS", "ERROR")
+
+	for _, f := range history.Data.Functions {
+		fmt.Fprintf(w, "%v\t%v\t%.2f\t%v\t%v\t%v\t%v\t%v\n",
+			f.Epoch, f.FuncId, f.Duration, f.Syncs, f.Loss, f.Samples, formatShards(f), f.Error)
+	}
+
+	w.Flush()
+}
+
+// formatShards returns the document ranges trained by a
+// function, marking the ones retrained after a failure
+func formatShards(record api.FunctionRecord) string {
+	if len(record.Shards) == 0 {
+		return "-"
+	}
+
+	ranges := make([]string, len(record.Shards))
+	for i, s := range record.Shards {
+		ranges[i] = fmt.Sprintf("%d:%d", s.Start, s.End)
+	}
+
+	res := strings.Join(ranges, ",")
+	if record.Recovery {
+		res += " (recovery)"
+	}
+	return res
+}
+
+// printCrossValidation prints the results of each fold of
+// a cross validation run along with their mean and std
+func printCrossValidation(summary *api.CrossValidationSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", "FOLD", "JOB", "STATUS", "ACCURACY", "LOSS")
+
+	for _, f := range summary.Folds {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.4f\t%.4f\n", f.Fold, f.JobId, f.Status, f.Accuracy, f.Loss)
+	}
+	fmt.Fprintf(w, "%v\t\t\t%.4f ± %.4f\t%.4f ± %.4f\n", "MEAN",
+		summary.MeanAccuracy, summary.StdAccuracy, summary.MeanLoss, summary.StdLoss)
+
+	w.Flush()
+}
+
+// printReport prints the metrics of each class and the
+// confusion matrix of the final evaluation of a task
+func printReport(report *api.EvaluationReport) {
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", "CLASS", "PRECISION", "RECALL", "F1", "SUPPORT")
+	for _, c := range report.Classes {
+		fmt.Fprintf(w, "%v\t%.4f\t%.4f\t%.4f\t%v\n", c.Class, c.Precision, c.Recall, c.F1, c.Support)
+	}
+	fmt.Fprintf(w, "\n%v\t%.2f%%\n", "ACCURACY", report.Accuracy)
+	fmt.Fprintf(w, "%v\t%.4f\n", "MACRO F1", report.MacroF1)
+	fmt.Fprintf(w, "%v\t%v\n", "SAMPLES", report.Samples)
+	w.Flush()
+
+	// rows are the true classes and columns the predicted ones
+	fmt.Println("\nConfusion matrix (rows: true class, columns: predicted class)")
+	w = tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "\t")
+	for class := range report.Confusion {
+		fmt.Fprintf(w, "%v\t", class)
+	}
+	fmt.Fprintln(w)
+	for class, row := range report.Confusion {
+		fmt.Fprintf(w, "%v\t", class)
+		for _, count := range row {
+			fmt.Fprintf(w, "%v\t", count)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
 // deleteHistory deletes a history from the database given the taskId
 func deleteHistory(_ *cobra.Command, _ []string) error {
 	client, err := kubemlClient.MakeKubemlClient()
@@ -132,12 +232,24 @@ func listHistories(_ *cobra.Command, _ []string) error {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
-	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", "NAME", "MODEL", "DATASET", "EPOCHS", "BATCH", "LR", "PARALLELISM", "K", "STATIC", "ACCURACY", "LOSS", "TIME (s)")
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", "NAME", "STATUS", "MODEL", "DATASET", "EPOCHS", "BATCH", "LR", "PARALLELISM", "K", "STATIC", "ACCURACY", "LOSS", "TIME (s)")
 
 	for _, h := range histories {
 
-		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
-			h.Id, h.Task.ModelType, h.Task.Dataset, h.Task.Epochs, h.Task.BatchSize, h.Task.LearningRate,
+		// cross validation runs show the mean of the folds
+		if cv := h.CrossValidation; cv != nil {
+			h.Data.Accuracy = []float64{cv.MeanAccuracy}
+			h.Data.ValidationLoss = []float64{cv.MeanLoss}
+		}
+
+		// histories saved before the status was tracked are finished
+		status := h.Status
+		if status == "" {
+			status = api.StatusSucceeded
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			h.Id, status, h.Task.ModelType, h.Task.Dataset, h.Task.Epochs, h.Task.BatchSize, h.Task.LearningRate,
 			getMeanParallelism(h.Data.Parallelism), h.Task.Options.K, h.Task.Options.StaticParallelism,
 			last(h.Data.Accuracy), last(h.Data.ValidationLoss), last(h.Data.EpochDuration))
 	}
@@ -166,6 +278,8 @@ func init() {
 
 	// Get command
 	historyGetCmd.Flags().StringVar(&taskId, "id", "", "Id of the train task (required)")
+	historyGetCmd.Flags().BoolVar(&showFunctions, "functions", false, "Show the per-function breakdown of each epoch")
+	historyGetCmd.Flags().BoolVar(&showReport, "report", false, "Show the per-class report of the final evaluation")
 
 	// Delete command
 	historyDeleteCmd.Flags().StringVar(&taskId, "id", "", "Id of the train task (required)")
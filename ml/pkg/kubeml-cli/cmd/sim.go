@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	kubemlClient "github.com/diegostock12/kubeml/ml/pkg/controller/client"
+	"github.com/diegostock12/kubeml/ml/pkg/scheduler"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+)
+
+var (
+	workloadFile   string
+	historyFile    string
+	historyIds     []string
+	simPolicies    []string
+	simBudget      int
+	simMaxParallel int
+	simTeamShares  string
+
+	simCmd = &cobra.Command{
+		Use:   "sim",
+		Short: "Simulate a workload with the scheduling policies using the recorded histories",
+		RunE:  simulate,
+	}
+)
+
+// simulate replays the workload with each of the policies and
+// prints the makespan, completion time and function time of each
+func simulate(_ *cobra.Command, _ []string) error {
+	data, err := ioutil.ReadFile(workloadFile)
+	if err != nil {
+		return errors.Wrap(err, "could not read workload file")
+	}
+
+	var workload []scheduler.SimulationJob
+	if err := yaml.Unmarshal(data, &workload); err != nil {
+		return errors.Wrap(err, "could not parse workload file")
+	}
+	if len(workload) == 0 {
+		return errors.New("the workload has no jobs")
+	}
+
+	histories, err := loadHistories()
+	if err != nil {
+		return err
+	}
+
+	models := scheduler.FitEpochModels(histories)
+	fallback, err := scheduler.FitEpochModel(histories)
+	if err != nil {
+		return errors.Wrap(err, "could not fit the epoch model")
+	}
+
+	shares, err := scheduler.ParseTeamShares(simTeamShares)
+	if err != nil {
+		return err
+	}
+	opts := scheduler.Options{
+		FunctionBudget: simBudget,
+		TeamShares:     shares,
+		MaxParallelism: simMaxParallel,
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", "POLICY", "JOBS", "MAKESPAN", "AVG COMPLETION", "FUNCTION-SECONDS")
+
+	for _, policy := range simPolicies {
+		res, err := scheduler.Simulate(zap.NewNop(), workload, models, &fallback, policy, opts)
+		if err != nil {
+			return errors.Wrapf(err, "could not simulate policy %v", policy)
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%.2f\t%.2f\t%.2f\n",
+			res.Policy, res.Jobs, res.Makespan, res.AverageCompletion, res.FunctionSeconds)
+	}
+
+	return w.Flush()
+}
+
+// loadHistories reads the histories from a file if one was given, so the
+// simulation can run offline, or otherwise gets them from the controller
+func loadHistories() ([]api.History, error) {
+	if historyFile != "" {
+		data, err := ioutil.ReadFile(historyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read history file")
+		}
+
+		var histories []api.History
+		if err := json.Unmarshal(data, &histories); err != nil {
+			return nil, errors.Wrap(err, "could not parse history file")
+		}
+		return histories, nil
+	}
+
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(historyIds) == 0 {
+		return client.V1().Histories().List()
+	}
+
+	var histories []api.History
+	for _, id := range historyIds {
+		h, err := client.V1().Histories().Get(id)
+		if err != nil {
+			return nil, err
+		}
+		histories = append(histories, *h)
+	}
+	return histories, nil
+}
+
+func init() {
+	rootCmd.AddCommand(simCmd)
+
+	simCmd.Flags().StringVarP(&workloadFile, "workload", "w", "", "Yaml or json file with the jobs of the workload and their arrival times (required)")
+	simCmd.Flags().StringVar(&historyFile, "history-file", "", "Json file with a list of histories, instead of the ones in the cluster")
+	simCmd.Flags().StringSliceVar(&historyIds, "histories", nil, "Ids of the histories used to fit the epoch durations, by default all of them")
+	simCmd.Flags().StringSliceVar(&simPolicies, "policies",
+		[]string{api.PolicyStatic, api.PolicyThroughput, api.PolicyConvergence, api.PolicyStepSearch},
+		"Scheduling policies to compare")
+	simCmd.Flags().IntVar(&simBudget, "budget", 0, "Function budget of the simulated cluster, 0 for no limit")
+	simCmd.Flags().IntVar(&simMaxParallel, "max-parallelism", 0, "Maximum parallelism of a job, 0 for no limit")
+	simCmd.Flags().StringVar(&simTeamShares, "team-shares", "", "Weights of the teams sharing the budget, e.g. vision=2,nlp=1")
+	simCmd.MarkFlagRequired("workload")
+}
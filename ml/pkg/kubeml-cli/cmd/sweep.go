@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	kubemlClient "github.com/diegostock12/kubeml/ml/pkg/controller/client"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+)
+
+var (
+	sweepFile string
+	sweepId   string
+
+	sweepCmd = &cobra.Command{
+		Use:   "sweep",
+		Short: "Manage hyperparameter sweeps",
+	}
+
+	sweepCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create a sweep from a yaml definition",
+		RunE:  createSweep,
+	}
+
+	sweepListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the sweeps and their best trial",
+		RunE:  listSweeps,
+	}
+
+	sweepGetCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Get a sweep and its trials",
+		RunE:  getSweep,
+	}
+
+	sweepStopCmd = &cobra.Command{
+		Use:   "stop",
+		Short: "Stop all the trials of a sweep",
+		RunE:  stopSweep,
+	}
+)
+
+// createSweep reads the sweep definition and sends it to the controller
+func createSweep(_ *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(sweepFile)
+	if err != nil {
+		return errors.Wrap(err, "could not read sweep file")
+	}
+
+	var req api.SweepRequest
+	if err := yaml.Unmarshal(data, &req); err != nil {
+		return errors.Wrap(err, "could not parse sweep file")
+	}
+
+	id, err := client.V1().Sweeps().Create(&req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(id)
+	return nil
+}
+
+// getSweep prints the sweep with its trials
+func getSweep(_ *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	sweep, err := client.V1().Sweeps().Get(sweepId)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(sweep, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal json")
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
+
+// listSweeps prints a summary table of the sweeps
+func listSweeps(_ *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	sweeps, err := client.V1().Sweeps().List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", "ID", "NAME", "STRATEGY", "STATUS", "TRIALS", "BEST", "METRIC")
+
+	for _, sweep := range sweeps {
+		best, metric := "-", "-"
+		for _, trial := range sweep.Trials {
+			if sweep.BestTrial != "" && trial.JobId == sweep.BestTrial && trial.Metric != nil {
+				best = trial.JobId
+				metric = fmt.Sprintf("%v=%.4f", sweep.Request.Metric, *trial.Metric)
+			}
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			sweep.Id, sweep.Request.Name, sweep.Request.Strategy, sweep.Status,
+			len(sweep.Trials), best, metric)
+	}
+
+	return w.Flush()
+}
+
+func stopSweep(_ *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	return client.V1().Sweeps().Stop(sweepId)
+}
+
+func init() {
+	rootCmd.AddCommand(sweepCmd)
+	sweepCmd.AddCommand(sweepCreateCmd)
+	sweepCmd.AddCommand(sweepListCmd)
+	sweepCmd.AddCommand(sweepGetCmd)
+	sweepCmd.AddCommand(sweepStopCmd)
+
+	sweepCreateCmd.Flags().StringVarP(&sweepFile, "file", "f", "", "Yaml file with the sweep definition (required)")
+	sweepCreateCmd.MarkFlagRequired("file")
+
+	sweepGetCmd.Flags().StringVar(&sweepId, "id", "", "Id of the sweep")
+	sweepGetCmd.MarkFlagRequired("id")
+
+	sweepStopCmd.Flags().StringVar(&sweepId, "id", "", "Id of the sweep")
+	sweepStopCmd.MarkFlagRequired("id")
+}
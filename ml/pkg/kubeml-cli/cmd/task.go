@@ -2,14 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
 	kubemlClient "github.com/diegostock12/kubeml/ml/pkg/controller/client"
 	"github.com/fission/fission/pkg/crd"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
 const KubemlNamespace = "kubeml"
@@ -35,6 +38,37 @@ var (
 		RunE:  stopTask,
 	}
 
+	tasksPauseCmd = &cobra.Command{
+		Use:   "pause",
+		Short: "Pause a task after its current epoch",
+		RunE:  pauseTask,
+	}
+
+	tasksResumeCmd = &cobra.Command{
+		Use:   "resume",
+		Short: "Resume a paused task",
+		RunE:  resumeTask,
+	}
+
+	tasksEventsCmd = &cobra.Command{
+		Use:   "events",
+		Short: "Show the timeline of events of a task",
+		RunE:  taskEvents,
+	}
+
+	tasksUpdateCmd = &cobra.Command{
+		Use:   "update",
+		Short: "Update the hyperparameters of a running task",
+		RunE:  updateTask,
+	}
+
+	// variables used in the update command
+	updateLr            float32
+	updateK             int
+	updateBatchSize     int
+	updateValidateEvery int
+	updateGoalAccuracy  float64
+
 	tasksPruneCmd = &cobra.Command{
 		Use:   "prune",
 		Short: "Prune finished tasks",
@@ -58,6 +92,101 @@ func stopTask(_ *cobra.Command, _ []string) error {
 
 }
 
+// taskEvents prints the events recorded by a task, which
+// are available also once the task is finished
+func taskEvents(_ *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	events, err := client.V1().Tasks().Events(id)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", "TIME", "EPOCH", "TYPE", "MESSAGE", "DETAILS")
+
+	for _, event := range events {
+		message := event.Message
+		if message == "" {
+			message = "-"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n",
+			event.Timestamp.Local().Format("15:04:05.000"), event.Epoch, event.Type,
+			message, formatDetails(event.Details))
+	}
+
+	return w.Flush()
+}
+
+// formatDetails returns the details of an event as key=value pairs sorted by key
+func formatDetails(details map[string]interface{}) string {
+	if len(details) == 0 {
+		return "-"
+	}
+
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%v=%v", k, details[k])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// updateTask sends the hyperparameters set in the flags to the
+// task, the rest are left untouched
+func updateTask(cmd *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	var update api.HyperparameterUpdate
+	flags := cmd.Flags()
+	if flags.Changed("lr") {
+		update.LearningRate = &updateLr
+	}
+	if flags.Changed("K") {
+		update.K = &updateK
+	}
+	if flags.Changed("batch") {
+		update.BatchSize = &updateBatchSize
+	}
+	if flags.Changed("validate-every") {
+		update.ValidateEvery = &updateValidateEvery
+	}
+	if flags.Changed("goal-accuracy") {
+		update.GoalAccuracy = &updateGoalAccuracy
+	}
+
+	return client.V1().Tasks().Update(id, update)
+}
+
+func pauseTask(_ *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	return client.V1().Tasks().Pause(id)
+}
+
+func resumeTask(_ *cobra.Command, _ []string) error {
+	client, err := kubemlClient.MakeKubemlClient()
+	if err != nil {
+		return err
+	}
+
+	return client.V1().Tasks().Resume(id)
+}
+
 // pruneTasks deletes all the tasks from the namespace that are
 // still left after finishing
 func pruneTasks(_ *cobra.Command, _ []string) error {
@@ -140,13 +269,21 @@ func listTasks(_ *cobra.Command, _ []string) error {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
-	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", "NAME", "FUNCTION", "DATASET", "MODEL", "EPOCHS", "BATCH", "LR")
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+		"NAME", "FUNCTION", "DATASET", "MODEL", "EPOCHS", "BATCH", "LR", "STATE", "EPOCH", "UPDATED")
 
 	// Display functions that use the default environment
 	for _, task := range tasks {
-		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+		state := task.Job.State
+		phase := string(state.Phase)
+		if state.QueuePosition > 0 {
+			phase = fmt.Sprintf("%v (#%d)", state.Phase, state.QueuePosition)
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
 			task.Job.JobId, task.Parameters.FunctionName, task.Parameters.Dataset,
-			task.Parameters.ModelType, task.Parameters.Epochs, task.Parameters.BatchSize, task.Parameters.LearningRate)
+			task.Parameters.ModelType, task.Parameters.Epochs, task.Parameters.BatchSize, task.Parameters.LearningRate,
+			phase, state.Epoch, sinceTransition(state.LastTransition))
 	}
 
 	w.Flush()
@@ -154,14 +291,44 @@ func listTasks(_ *cobra.Command, _ []string) error {
 	return nil
 }
 
+// sinceTransition formats the time since the last
+// change in the state of a task
+func sinceTransition(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return time.Since(t).Truncate(time.Second).String() + " ago"
+}
+
 func init() {
 	rootCmd.AddCommand(tasksCmd)
 	tasksCmd.AddCommand(tasksListCmd)
 	tasksCmd.AddCommand(tasksStopCmd)
 	tasksCmd.AddCommand(tasksPruneCmd)
+	tasksCmd.AddCommand(tasksPauseCmd)
+	tasksCmd.AddCommand(tasksResumeCmd)
+	tasksCmd.AddCommand(tasksUpdateCmd)
+	tasksCmd.AddCommand(tasksEventsCmd)
 
 	tasksListCmd.Flags().BoolVar(&short, "short", false, "Trigger short format")
 
 	tasksStopCmd.Flags().StringVar(&id, "id", "", "Id of the task")
 	tasksStopCmd.MarkFlagRequired("id")
+
+	tasksPauseCmd.Flags().StringVar(&id, "id", "", "Id of the task")
+	tasksPauseCmd.MarkFlagRequired("id")
+
+	tasksResumeCmd.Flags().StringVar(&id, "id", "", "Id of the task")
+	tasksResumeCmd.MarkFlagRequired("id")
+
+	tasksEventsCmd.Flags().StringVar(&id, "id", "", "Id of the task")
+	tasksEventsCmd.MarkFlagRequired("id")
+
+	tasksUpdateCmd.Flags().StringVar(&id, "id", "", "Id of the task")
+	tasksUpdateCmd.Flags().Float32Var(&updateLr, "lr", 0, "New learning rate")
+	tasksUpdateCmd.Flags().IntVar(&updateK, "K", 0, "New number of updates between syncs")
+	tasksUpdateCmd.Flags().IntVar(&updateBatchSize, "batch", 0, "New batch size")
+	tasksUpdateCmd.Flags().IntVar(&updateValidateEvery, "validate-every", 0, "Validate the network every N epochs")
+	tasksUpdateCmd.Flags().Float64Var(&updateGoalAccuracy, "goal-accuracy", 0, "New goal accuracy")
+	tasksUpdateCmd.MarkFlagRequired("id")
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
 )
 
 const (
@@ -23,14 +24,37 @@ var (
 	batchSize    int
 	lr           float32
 	functionName string
+	priority     string
+	owner        string
+	team         string
 
 	// variables used for the train options
 	validateEvery      int
+	validateEveryRound int     // validate every N merge rounds
+	valFraction        float64 // fraction of the test set validated
+	valParallelism     int     // number of validation functions
 	staticParallelism  bool
 	defaultParallelism int
+	minParallelism     int    // functions needed for the job to be admitted
+	maxParallelism     int    // maximum functions given to the job
+	policy             string // scheduling policy of the job
 	K                  int
-	sparseAvg          bool    // if true, it means we only synchronize once per epoch
-	goalAccuracy       float64 // accuracy objective, after which we'll stop the training
+	sparseAvg          bool              // if true, it means we only synchronize once per epoch
+	goalAccuracy       float64           // accuracy objective, after which we'll stop the training
+	metricAggregation  map[string]string // aggregation rule of the custom metrics
+	scaling            string            // rescaling of batch size or lr when parallelism changes
+	folds              int               // number of folds of a cross validation run
+	seed               int64             // seed of reproducible trainings
+	shuffleShards      bool              // whether to shuffle the shards of the functions every epoch
+	finalEvaluation    bool              // whether to evaluate the final model on the test set
+
+	// variables used for the adaptive K options
+	adaptiveK  string
+	minK       int
+	maxK       int
+	kFactor    float64
+	kEvery     int
+	kThreshold float64
 
 	trainCmd = &cobra.Command{
 		Use:   "train",
@@ -41,7 +65,7 @@ var (
 
 // train builds the request and sends it to the controller so
 // the job can be scheduled
-func train(_ *cobra.Command, _ []string) error {
+func train(cmd *cobra.Command, _ []string) error {
 	client, err := kubemlClient.MakeKubemlClient()
 	if err != nil {
 		return err
@@ -60,15 +84,47 @@ func train(_ *cobra.Command, _ []string) error {
 		Dataset:      dataset,
 		LearningRate: lr,
 		FunctionName: functionName,
+		Priority:     priority,
+		Owner:        owner,
+		Team:         team,
 		Options: api.TrainOptions{
 			DefaultParallelism: defaultParallelism,
 			StaticParallelism:  staticParallelism,
 			ValidateEvery:      validateEvery,
+			MinParallelism:     minParallelism,
+			MaxParallelism:     maxParallelism,
+			Policy:             policy,
 			K:                  K,
 			GoalAccuracy:       goalAccuracy,
+			MetricAggregation:  metricAggregation,
+			Scaling:            scaling,
+			Folds:              folds,
+			ShuffleShards:      shuffleShards,
+			FinalEvaluation:    finalEvaluation,
+
+			ValidationFraction:    valFraction,
+			ValidationParallelism: valParallelism,
+			ValidateEveryRounds:   validateEveryRound,
 		},
 	}
 
+	// only set the seed if given, so trainings are not reproducible by default
+	if cmd.Flags().Changed("seed") {
+		req.Options.Seed = &seed
+	}
+
+	// set the adaptive K options if a policy is given
+	if adaptiveK != "" && adaptiveK != api.AdaptiveKStatic {
+		req.Options.AdaptiveK = &api.AdaptiveKOptions{
+			Policy:    adaptiveK,
+			MinK:      minK,
+			MaxK:      maxK,
+			Factor:    kFactor,
+			Every:     kEvery,
+			Threshold: kThreshold,
+		}
+	}
+
 	// validate the train request fields
 	if err := validateTrainRequest(client, &req); err != nil {
 		return err
@@ -105,6 +161,86 @@ func validateTrainRequest(client *kubemlClient.KubemlClient, req *api.TrainReque
 		e = multierror.Append(e, errors.New("learning rate should be bigger than zero"))
 	}
 
+	// check the aggregation rules of the custom metrics
+	for metric, rule := range req.Options.MetricAggregation {
+		switch rule {
+		case api.AggregationMean, api.AggregationSum, api.AggregationMax:
+		default:
+			e = multierror.Append(e, fmt.Errorf("unknown aggregation \"%v\" for metric \"%v\"", rule, metric))
+		}
+	}
+
+	// check the scaling mode
+	switch req.Options.Scaling {
+	case api.ScalingNone, api.ScalingConstantBatch, api.ScalingLinearLr:
+	default:
+		e = multierror.Append(e, fmt.Errorf("unknown scaling mode \"%v\"", req.Options.Scaling))
+	}
+
+	// check the validation options
+	if f := req.Options.ValidationFraction; f < 0 || f > 1 {
+		e = multierror.Append(e, errors.New("validation fraction should be between 0 and 1"))
+	}
+	if req.Options.ValidationParallelism < 0 || req.Options.ValidateEveryRounds < 0 {
+		e = multierror.Append(e, errors.New("validation parallelism and rounds should not be negative"))
+	}
+
+	// check the scheduling policy
+	switch req.Options.Policy {
+	case "", api.PolicyStatic, api.PolicyThroughput, api.PolicyConvergence, api.PolicyStepSearch:
+	default:
+		e = multierror.Append(e, fmt.Errorf("unknown scheduling policy \"%v\"", req.Options.Policy))
+	}
+
+	// check the priority class
+	switch req.Priority {
+	case api.PriorityLow, api.PriorityNormal, api.PriorityHigh:
+	default:
+		e = multierror.Append(e, fmt.Errorf("unknown priority \"%v\"", req.Priority))
+	}
+
+	// check the minimum parallelism
+	if req.Options.MinParallelism < 0 || req.Options.MinParallelism > req.Options.DefaultParallelism {
+		e = multierror.Append(e, errors.New("min parallelism should not be bigger than the starting parallelism"))
+	}
+
+	// check the maximum parallelism, zero means no limit
+	if req.Options.MaxParallelism < 0 ||
+		(req.Options.MaxParallelism > 0 && req.Options.MaxParallelism < req.Options.DefaultParallelism) {
+		e = multierror.Append(e, errors.New("max parallelism should not be smaller than the starting parallelism"))
+	}
+
+	// check the number of folds
+	if req.Options.Folds < 0 || req.Options.Folds == 1 {
+		e = multierror.Append(e, errors.New("folds should be at least 2"))
+	}
+
+	// check the adaptive K options
+	if opts := req.Options.AdaptiveK; opts != nil {
+		switch opts.Policy {
+		case api.AdaptiveKSchedule:
+			if opts.Every <= 0 {
+				e = multierror.Append(e, errors.New("k-every should be a positive value"))
+			}
+		case api.AdaptiveKDivergence:
+			if opts.Threshold <= 0 {
+				e = multierror.Append(e, errors.New("k-threshold should be bigger than zero"))
+			}
+		default:
+			e = multierror.Append(e, fmt.Errorf("unknown adaptive K policy \"%v\"", opts.Policy))
+		}
+
+		if req.Options.K <= 0 {
+			e = multierror.Append(e, errors.New("adaptive K needs a positive starting K"))
+		}
+		if opts.MinK <= 0 || (opts.MaxK > 0 && opts.MaxK < opts.MinK) {
+			e = multierror.Append(e, errors.New("min-k should be positive and not bigger than max-k"))
+		}
+		if opts.Factor <= 1 {
+			e = multierror.Append(e, errors.New("k-factor should be bigger than one"))
+		}
+	}
+
 	// check dataset exists
 	if exists, err := datasetExists(client, dataset); err != nil || !exists {
 		e = multierror.Append(e, fmt.Errorf("dataset \"%v\" does not exist", dataset))
@@ -158,11 +294,33 @@ func init() {
 
 	// optional params
 	trainCmd.Flags().IntVar(&validateEvery, "validate-every", 0, "Validate the network every N epochs")
+	trainCmd.Flags().IntVar(&validateEveryRound, "validate-every-rounds", 0, "Validate the network every N merge rounds")
+	trainCmd.Flags().Float64Var(&valFraction, "val-fraction", 1, "Fraction of the test set used in the validations before the final one")
+	trainCmd.Flags().IntVar(&valParallelism, "val-parallelism", 0, "Number of validation functions, by default the train parallelism")
 	trainCmd.Flags().IntVar(&defaultParallelism, "parallelism", api.DebugParallelism, "Starting level of parallelism")
+	trainCmd.Flags().StringVar(&policy, "policy", "", "Scheduling policy (static, throughput, convergence or step_search), by default the one of the scheduler")
+	trainCmd.Flags().StringVar(&priority, "priority", api.PriorityNormal, "Priority of the job (low, normal or high), jobs of higher priority can preempt the others")
+	trainCmd.Flags().StringVar(&owner, "owner", os.Getenv("USER"), "Owner of the job, used to share the functions fairly")
+	trainCmd.Flags().StringVar(&team, "team", "", "Team of the job, the functions are shared fairly among teams")
+	trainCmd.Flags().IntVar(&minParallelism, "min-parallelism", 1, "Minimum parallelism, the job waits in the queue until it is available")
+	trainCmd.Flags().IntVar(&maxParallelism, "max-parallelism", 0, "Maximum parallelism given to the job by the scheduler, 0 for no limit")
 	trainCmd.Flags().BoolVar(&staticParallelism, "static", false, "Whether to keep parallelism static")
 	trainCmd.Flags().IntVar(&K, "K", -1, "Sync every K updates to the local network")
 	trainCmd.Flags().BoolVar(&sparseAvg, "sparse-avg", false, "If true, average only once per epoch, no matter the value of K")
 	trainCmd.Flags().Float64Var(&goalAccuracy, "goal-accuracy", 100, "Accuracy after which the training will stop")
+	trainCmd.Flags().StringToStringVar(&metricAggregation, "metric-agg", nil, "Aggregation of the custom metrics (mean, sum or max, by default the mean weighted by the samples of each function), e.g. f1=mean,errors=sum")
+
+	trainCmd.Flags().StringVar(&scaling, "scaling", api.ScalingNone, "Rescaling when parallelism changes (none, constant_batch or linear_lr)")
+	trainCmd.Flags().BoolVar(&shuffleShards, "shuffle-shards", false, "Shuffle the documents assigned to each function every epoch")
+	trainCmd.Flags().BoolVar(&finalEvaluation, "final-evaluation", false, "Evaluate the final model on the test set with a per-class report")
+	trainCmd.Flags().Int64Var(&seed, "seed", 0, "Seed used to make the training reproducible")
+	trainCmd.Flags().IntVar(&folds, "folds", 0, "Run a k-fold cross validation with this number of folds")
+	trainCmd.Flags().StringVar(&adaptiveK, "adaptive-k", api.AdaptiveKStatic, "Policy used to adapt K (static, schedule or divergence)")
+	trainCmd.Flags().IntVar(&minK, "min-k", 1, "Minimum K when adapting it")
+	trainCmd.Flags().IntVar(&maxK, "max-k", 0, "Maximum K when adapting it, 0 for no limit")
+	trainCmd.Flags().Float64Var(&kFactor, "k-factor", 2, "Factor by which K is multiplied or divided when adapting it")
+	trainCmd.Flags().IntVar(&kEvery, "k-every", 1, "Epochs between K increases with the schedule policy")
+	trainCmd.Flags().Float64Var(&kThreshold, "k-threshold", 0.01, "Divergence over which K is decreased with the divergence policy")
 
 	trainCmd.MarkFlagRequired("dataset")
 	trainCmd.MarkFlagRequired("function")
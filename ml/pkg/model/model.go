@@ -1,6 +1,8 @@
 package model
 
 import (
+	"math"
+
 	"github.com/RedisAI/redisai-go/redisai"
 	"github.com/diegostock12/kubeml/ml/pkg/api"
 	"github.com/diegostock12/kubeml/ml/pkg/util"
@@ -8,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"gorgonia.org/tensor"
+	"sort"
 	"sync"
 )
 
@@ -40,6 +43,18 @@ type (
 
 		redisPool *redis.Pool
 
+		// sqNorm accumulates the squared norms of the models
+		// of the functions merged in the current round, used to
+		// compute the divergence between them
+		sqNorm float64
+
+		// deterministic models keep the layers of each function
+		// in buffered and sum them in the order of the function ids
+		// before averaging, so the result does not depend on the
+		// order in which the functions finish
+		deterministic bool
+		buffered      map[int]map[string]*Layer
+
 		// Internal Lock to be applied during the update
 		mu sync.Mutex
 	}
@@ -116,9 +131,17 @@ func (m *Model) Build() error {
 // Clear wipes the statedict of the model
 func (m *Model) Clear() {
 	m.StateDict = make(map[string]*Layer)
+	m.buffered = nil
+	m.sqNorm = 0
 	m.logger.Debug("Wiped model state")
 }
 
+// SetDeterministic sets whether the layers of the functions
+// are summed in the order of the function ids
+func (m *Model) SetDeterministic(deterministic bool) {
+	m.deterministic = deterministic
+}
+
 // Summary runs through the layers of a model and prints its info
 func (m *Model) Summary() {
 	for name, layer := range m.StateDict {
@@ -245,6 +268,24 @@ func (m *Model) buildLayer(redisClient *redisai.Client, name string) (*Layer, er
 
 }
 
+// Divergence returns the mean squared distance between the models of the
+// functions merged and their average, relative to the squared norm of the average.
+// It must be called once the model is averaged
+func (m *Model) Divergence(num int) float64 {
+	var avgNorm float64
+	for _, layer := range m.StateDict {
+		avgNorm += squaredNorm(layer.Weights)
+	}
+
+	if avgNorm == 0 || num == 0 {
+		return 0
+	}
+
+	// the mean of the squared norms minus the squared norm
+	// of the mean is the mean squared distance to the average
+	return math.Max(m.sqNorm/float64(num)-avgNorm, 0) / avgNorm
+}
+
 // Update fetches the layers saved by a function and adds them to the statedict
 func (m *Model) Update(funcId int) {
 
@@ -283,16 +324,21 @@ func (m *Model) Update(funcId int) {
 			return
 		}
 
-		if total, exists := m.StateDict[layerName]; !exists {
-			m.StateDict[layerName] = layer
-		} else {
-			total.Weights, err = total.Weights.Add(layer.Weights)
-			if err != nil {
-				m.logger.Error("Error adding weights",
-					zap.Error(err))
-
-				return
+		if m.deterministic {
+			if m.buffered == nil {
+				m.buffered = make(map[int]map[string]*Layer)
 			}
+			if m.buffered[funcId] == nil {
+				m.buffered[funcId] = make(map[string]*Layer)
+			}
+			m.buffered[funcId][layerName] = layer
+			continue
+		}
+
+		if err := m.addLayer(layerName, layer); err != nil {
+			m.logger.Error("Error adding weights",
+				zap.Error(err))
+			return
 		}
 	}
 
@@ -300,3 +346,46 @@ func (m *Model) Update(funcId int) {
 		zap.Int("funcId", funcId))
 
 }
+
+// addLayer adds the weights of a function layer to the statedict
+func (m *Model) addLayer(name string, layer *Layer) error {
+	m.sqNorm += squaredNorm(layer.Weights)
+
+	total, exists := m.StateDict[name]
+	if !exists {
+		m.StateDict[name] = layer
+		return nil
+	}
+
+	var err error
+	total.Weights, err = total.Weights.Add(layer.Weights)
+	return err
+}
+
+// reduce sums the buffered layers of the functions into the
+// statedict, in increasing order of the function ids
+func (m *Model) reduce() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	funcs := make([]int, 0, len(m.buffered))
+	for funcId := range m.buffered {
+		funcs = append(funcs, funcId)
+	}
+	sort.Ints(funcs)
+
+	for _, funcId := range funcs {
+		for _, name := range m.layerNames {
+			layer, exists := m.buffered[funcId][name]
+			if !exists {
+				continue
+			}
+			if err := m.addLayer(name, layer); err != nil {
+				return errors.Wrapf(err, "error adding layer %s of function %d", name, funcId)
+			}
+		}
+	}
+
+	m.buffered = nil
+	return nil
+}
@@ -27,6 +27,11 @@ func (psgd ParallelSGD) Average(m *Model, num int) error {
 
 	psgd.logger.Debug("Averaging", zap.Int("num", num))
 
+	// sum the layers kept by deterministic models
+	if err := m.reduce(); err != nil {
+		return err
+	}
+
 	var err error
 	for _, layer := range m.StateDict {
 		// divide the sum of the layer weights by the
@@ -31,6 +31,21 @@ func dimsToLength(dims ...int64) int64 {
 
 
 
+// squaredNorm returns the squared L2 norm of a float tensor,
+// other types of tensors are ignored
+func squaredNorm(t *tensor.Dense) float64 {
+	values, ok := t.Data().([]float32)
+	if !ok {
+		return 0
+	}
+
+	var norm float64
+	for _, v := range values {
+		norm += float64(v) * float64(v)
+	}
+	return norm
+}
+
 // blobToArray converts a byte array to an arrayof int64 with the same shape as indicated
 func blobtoIntArray(blob []byte, shape []int64)  ([]int64, error) {
 	// Get the total number of components of the tensor
@@ -67,6 +67,131 @@ func (ps *ParameterServer) stopTask(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// getHistory returns the history of a running job, fetched from the job itself
+func (ps *ParameterServer) getHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	ps.mu.RLock()
+	task, exists := ps.jobIndex[jobId]
+	ps.mu.RUnlock()
+
+	if !exists {
+		ps.logger.Error("Received history request for non-existing job",
+			zap.String("id", jobId))
+		http.Error(w, "Job does not exist", http.StatusNotFound)
+		return
+	}
+
+	resp, err := ps.jobClient.History(task)
+	if err != nil {
+		ps.logger.Error("could not get history from job",
+			zap.String("id", jobId),
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// pauseTask makes a task stop before its next epoch until resumed
+func (ps *ParameterServer) pauseTask(w http.ResponseWriter, r *http.Request) {
+	ps.sendJobCommand(w, r, "pause", ps.jobClient.Pause)
+}
+
+// resumeTask lets a paused task continue training
+func (ps *ParameterServer) resumeTask(w http.ResponseWriter, r *http.Request) {
+	ps.sendJobCommand(w, r, "resume", ps.jobClient.Resume)
+}
+
+// preemptTask forwards the preemption of a task by another of higher priority
+func (ps *ParameterServer) preemptTask(w http.ResponseWriter, r *http.Request) {
+	var preemption api.Preemption
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		ps.logger.Error("Could not read request body",
+			zap.Error(err))
+		http.Error(w, "could not read request body", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.Unmarshal(body, &preemption)
+	if err != nil {
+		ps.logger.Error("Could not unmarshal the preemption json",
+			zap.String("request", string(body)),
+			zap.Error(err))
+		http.Error(w, "could not unmarshal preemption", http.StatusBadRequest)
+		return
+	}
+
+	ps.sendJobCommand(w, r, "preempt", func(task *api.TrainTask) error {
+		return ps.jobClient.Preempt(task, preemption)
+	})
+}
+
+// updateHyperparameters forwards new hyperparameters to a running task
+func (ps *ParameterServer) updateHyperparameters(w http.ResponseWriter, r *http.Request) {
+	var update api.HyperparameterUpdate
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		ps.logger.Error("Could not read request body",
+			zap.Error(err))
+		http.Error(w, "could not read request body", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.Unmarshal(body, &update)
+	if err != nil {
+		ps.logger.Error("Could not unmarshal the update json",
+			zap.String("request", string(body)),
+			zap.Error(err))
+		http.Error(w, "could not unmarshal update", http.StatusBadRequest)
+		return
+	}
+
+	ps.sendJobCommand(w, r, "hyperparams", func(task *api.TrainTask) error {
+		return ps.jobClient.UpdateHyperparameters(task, update)
+	})
+}
+
+// sendJobCommand looks for the job in the index and forwards
+// the command to it, returning the error of the job if any
+func (ps *ParameterServer) sendJobCommand(
+	w http.ResponseWriter,
+	r *http.Request,
+	command string,
+	send func(task *api.TrainTask) error) {
+
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	ps.mu.RLock()
+	task, exists := ps.jobIndex[jobId]
+	ps.mu.RUnlock()
+
+	if !exists {
+		ps.logger.Error("Received request for non-existing job",
+			zap.String("command", command),
+			zap.String("id", jobId))
+		http.Error(w, "Job does not exist", http.StatusNotFound)
+		return
+	}
+
+	err := send(task)
+	if err != nil {
+		ps.logger.Error("could not send command to job",
+			zap.String("command", command),
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // updateTask Handles the responses from the scheduler to the
 // requests by the parameter servers to
 func (ps *ParameterServer) updateTask(w http.ResponseWriter, r *http.Request) {
@@ -118,6 +243,53 @@ func (ps *ParameterServer) updateTask(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// updateJobState receives the lifecycle changes of the jobs
+// and saves them in the index so they are shown with the tasks
+func (ps *ParameterServer) updateJobState(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	var state api.JobState
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		ps.logger.Error("Could not read state body",
+			zap.Error(err))
+		http.Error(w, "error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.Unmarshal(body, &state)
+	if err != nil {
+		ps.logger.Error("Could not unmarshal the state json",
+			zap.String("request", string(body)),
+			zap.Error(err))
+		http.Error(w, "error reading json body", http.StatusBadRequest)
+		return
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	task, exists := ps.jobIndex[jobId]
+	if !exists {
+		ps.logger.Error("Received state for non-existing job",
+			zap.String("id", jobId))
+		http.Error(w, "job not found in index", http.StatusBadRequest)
+		return
+	}
+
+	ps.logger.Debug("Job changed phase",
+		zap.String("jobId", jobId),
+		zap.String("phase", string(state.Phase)),
+		zap.Int("epoch", state.Epoch))
+
+	task.Job.State.Phase = state.Phase
+	task.Job.State.Epoch = state.Epoch
+	task.Job.State.LastTransition = state.LastTransition
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // deleteEntry deletes the task from the jobIndex
 func (ps *ParameterServer) deleteEntry(id string) {
 	ps.mu.Lock()
@@ -126,11 +298,18 @@ func (ps *ParameterServer) deleteEntry(id string) {
 	delete(ps.jobIndex, id)
 }
 
-func (ps *ParameterServer) updateEntry(id string, task *api.TrainTask) {
+// addEntry adds the task to the jobIndex, returning false if
+// there is already a task with the same id
+func (ps *ParameterServer) addEntry(id string, task *api.TrainTask) bool {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
+	if _, exists := ps.jobIndex[id]; exists {
+		return false
+	}
+
 	ps.jobIndex[id] = task
+	return true
 }
 
 // startTask Handles the request of the scheduler to create a
@@ -157,8 +336,15 @@ func (ps *ParameterServer) startTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// set the task even before trying to start it for visibility,
-	// we will update it later
-	ps.updateEntry(task.Job.JobId, &task)
+	// the job will then report the changes in its state
+	task.Job.State.Phase = api.PhasePending
+	task.Job.State.LastTransition = time.Now()
+	if !ps.addEntry(task.Job.JobId, &task) {
+		ps.logger.Error("Received start for already running job",
+			zap.String("jobId", task.Job.JobId))
+		http.Error(w, "job is already running", http.StatusConflict)
+		return
+	}
 
 	ps.logger.Debug("About to create pod")
 	// if we are deploying the jobs in different pods
@@ -174,8 +360,10 @@ func (ps *ParameterServer) startTask(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unable to create resources for job", http.StatusInternalServerError)
 			return
 		}
+		ps.mu.Lock()
 		task.Job.Pod = pod
 		task.Job.Svc = svc
+		ps.mu.Unlock()
 
 		ps.logger.Debug("assigned pod to task",
 			zap.Any("name", pod.Name),
@@ -200,6 +388,7 @@ func (ps *ParameterServer) startTask(w http.ResponseWriter, r *http.Request) {
 					ps.logger.Debug("error sending request to task, retrying...", zap.Error(err))
 					continue
 				}
+				ps.deleteEntry(task.Job.JobId)
 				http.Error(w, "unable to send task for job", http.StatusInternalServerError)
 				return
 			}
@@ -211,12 +400,14 @@ func (ps *ParameterServer) startTask(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// if we are deploying them in the same pod, create a channel to communicate
 		ch := make(chan *api.JobState)
+		ps.mu.Lock()
 		task.Job.Channel = ch
+		task.Job.State.Phase = api.PhaseInitializing
+		ps.mu.Unlock()
 		job := train.NewTrainJob(ps.logger, &task, ch, ps.scheduler)
 		go job.Train()
 	}
 
-	ps.updateEntry(task.Job.JobId, &task)
 	taskStarted(TrainTask)
 	w.WriteHeader(http.StatusOK)
 }
@@ -282,11 +473,7 @@ func (ps *ParameterServer) jobFinish(w http.ResponseWriter, r *http.Request) {
 	clearMetrics(jobId)
 
 	// communicate the scheduler that the job is done
-	err := ps.scheduler.FinishJob(jobId)
-	if err != nil {
-		ps.logger.Error("Error sending finish to scheduler",
-			zap.Error(err))
-	}
+	go ps.finishInScheduler(jobId)
 
 	// delete the pod and service if standalone
 	if ps.deployStandaloneJobs {
@@ -326,6 +513,27 @@ func (ps *ParameterServer) jobFinish(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// finishInScheduler tells the scheduler that a job finished, retrying
+// with backoff so the functions of the job are not left allocated if
+// the scheduler is briefly unreachable. A scheduler that stays down
+// releases the job when it restores its tasks after restarting
+func (ps *ParameterServer) finishInScheduler(jobId string) {
+	var retries = 10
+	for i := 0; i < retries; i++ {
+		err := ps.scheduler.FinishJob(jobId)
+		if err == nil {
+			return
+		}
+
+		ps.logger.Error("Error sending finish to scheduler",
+			zap.String("jobId", jobId),
+			zap.Error(err))
+		if i < retries-1 {
+			time.Sleep(200 * time.Duration(2*i+1) * time.Millisecond)
+		}
+	}
+}
+
 // Handle Kubernetes heartbeats
 func (ps *ParameterServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
@@ -338,9 +546,15 @@ func (ps *ParameterServer) GetHandler() http.Handler {
 	r.HandleFunc("/update/{jobId}", ps.updateTask).Methods("POST")
 	r.HandleFunc("/health", ps.handleHealth).Methods("GET")
 	r.HandleFunc("/metrics/{jobId}", ps.updateJobMetrics).Methods("POST")
+	r.HandleFunc("/state/{jobId}", ps.updateJobState).Methods("POST")
 	r.HandleFunc("/finish/{jobId}", ps.jobFinish).Methods("POST")
 	r.HandleFunc("/stop/{jobId}", ps.stopTask).Methods("DELETE")
+	r.HandleFunc("/pause/{jobId}", ps.pauseTask).Methods("POST")
+	r.HandleFunc("/resume/{jobId}", ps.resumeTask).Methods("POST")
+	r.HandleFunc("/preempt/{jobId}", ps.preemptTask).Methods("POST")
+	r.HandleFunc("/hyperparams/{jobId}", ps.updateHyperparameters).Methods("POST")
 	r.HandleFunc("/tasks", ps.listTasks).Methods("GET")
+	r.HandleFunc("/history/{jobId}", ps.getHistory).Methods("GET")
 	return r
 }
 
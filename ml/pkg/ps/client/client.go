@@ -56,6 +56,119 @@ func (c *Client) StopTask(id string) error {
 
 }
 
+// JobHistory returns the history of a running task up to its current epoch
+func (c *Client) JobHistory(id string) (*api.JobHistory, error) {
+	url := c.psUrl + "/history/" + id
+
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "error performing request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading response body")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(body))
+	}
+
+	var history api.JobHistory
+	if err := json.Unmarshal(body, &history); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal history")
+	}
+
+	return &history, nil
+}
+
+// UpdateHyperparameters sends the new hyperparameters of a task
+// to the parameter server, which forwards them to the job
+func (c *Client) UpdateHyperparameters(id string, update api.HyperparameterUpdate) error {
+	url := c.psUrl + "/hyperparams/" + id
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal hyperparameters")
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not handle request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+
+	return nil
+}
+
+// PauseTask pauses the task given the task id after its current epoch
+func (c *Client) PauseTask(id string) error {
+	return c.sendCommand("/pause/", id)
+}
+
+// ResumeTask resumes the paused task given the task id
+func (c *Client) ResumeTask(id string) error {
+	return c.sendCommand("/resume/", id)
+}
+
+// PreemptTask tells a task that its functions were taken by a task of
+// higher priority, so it is scaled down or paused after its current epoch
+func (c *Client) PreemptTask(id string, preemption api.Preemption) error {
+	url := c.psUrl + "/preempt/" + id
+
+	body, err := json.Marshal(preemption)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal preemption")
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not handle request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+
+	return nil
+}
+
+// sendCommand posts an empty request for a task to the
+// parameter server and returns the error message if it fails
+func (c *Client) sendCommand(path, id string) error {
+	url := c.psUrl + path + id
+
+	resp, err := c.httpClient.Post(url, "text/plain", nil)
+	if err != nil {
+		return errors.Wrap(err, "could not handle request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+
+	return nil
+}
+
 // ListTasks returns the response of the tasks in a byte format
 // since the usage will only be internally, the controller will just redirect the bytes
 // to the requester
@@ -137,6 +250,33 @@ func (c *Client) UpdateMetrics(jobId string, update *api.MetricUpdate) error {
 	return nil
 }
 
+// UpdateState reports the new lifecycle phase of a job to the
+// parameter server so it is visible when listing the tasks
+func (c *Client) UpdateState(jobId string, state *api.JobState) error {
+	url := c.psUrl + "/state/" + jobId
+
+	body, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal state")
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not send state to the ps")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+
+	return nil
+}
+
 // JobFinished communicates to the parameter server that a job has finished. The PS
 // will then clear its index, metrics and also communicate with the Scheduler
 func (c *Client) JobFinished(jobId string, exitErr error) error {
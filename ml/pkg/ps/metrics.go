@@ -4,6 +4,7 @@ import (
 	"github.com/diegostock12/kubeml/ml/pkg/api"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sync"
 )
 
 type (
@@ -26,6 +27,15 @@ var (
 	// of tasks of each type (training, inference) currently happening
 	labelsPS = []string{"type"}
 
+	// labelsCustom identify the custom metrics returned by the
+	// functions of a job in the train or validation phase
+	labelsCustom = []string{"jobid", "phase", "metric"}
+
+	// customLabels keeps the custom metrics exported by each job
+	// so they can be deleted once the job is finished
+	customLabels   = make(map[string]map[[2]string]struct{})
+	customLabelsMu sync.Mutex
+
 	// Metrics for the job
 	// validation and train loss,
 	// accuracy,
@@ -70,6 +80,22 @@ var (
 		labelsJob,
 	)
 
+	iterationLoss = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kubeml_job_iteration_loss",
+			Help: "Train loss of the last merge round of a train job",
+		},
+		labelsJob,
+	)
+
+	customMetric = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kubeml_job_metric",
+			Help: "Custom metrics returned by the functions of a train job",
+		},
+		labelsCustom,
+	)
+
 	// Parameter server level metrics
 	tasksRunning = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -93,6 +119,32 @@ func updateMetrics(jobId string, metrics api.MetricUpdate) {
 	trainLoss.WithLabelValues(jobId).Set(metrics.TrainLoss)
 	epochDuration.WithLabelValues(jobId).Set(metrics.EpochDuration)
 	parallelism.WithLabelValues(jobId).Set(metrics.Parallelism)
+	iterationLoss.WithLabelValues(jobId).Set(metrics.IterationLoss)
+
+	updateCustomMetrics(jobId, "train", metrics.TrainMetrics)
+	updateCustomMetrics(jobId, "validation", metrics.ValidationMetrics)
+}
+
+// updateCustomMetrics sets the gauges of the custom metrics of a job
+// and remembers their labels so they can be cleared afterwards
+func updateCustomMetrics(jobId, phase string, metrics map[string]float64) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	customLabelsMu.Lock()
+	defer customLabelsMu.Unlock()
+
+	labels, exists := customLabels[jobId]
+	if !exists {
+		labels = make(map[[2]string]struct{})
+		customLabels[jobId] = labels
+	}
+
+	for name, value := range metrics {
+		customMetric.WithLabelValues(jobId, phase, name).Set(value)
+		labels[[2]string{phase, name}] = struct{}{}
+	}
 }
 
 // clearMetrics deletes the metrics associated with a jobId after
@@ -103,6 +155,14 @@ func clearMetrics(jobId string) {
 	trainLoss.DeleteLabelValues(jobId)
 	parallelism.DeleteLabelValues(jobId)
 	epochDuration.DeleteLabelValues(jobId)
+	iterationLoss.DeleteLabelValues(jobId)
+
+	customLabelsMu.Lock()
+	defer customLabelsMu.Unlock()
+	for label := range customLabels[jobId] {
+		customMetric.DeleteLabelValues(jobId, label[0], label[1])
+	}
+	delete(customLabels, jobId)
 }
 
 // taskStarted updates the gauges for tasks in currently
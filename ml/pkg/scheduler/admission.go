@@ -0,0 +1,505 @@
+package scheduler
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"sort"
+	"sync"
+)
+
+type (
+	// admission keeps track of the functions allocated to the running tasks so
+	// that together they do not go over the function budget of the cluster,
+	// and that each team stays within its fair share of it when others are waiting.
+	// A budget of zero means that there is no limit
+	admission struct {
+		budget      int
+		shares      map[string]float64
+		allocations map[string]*allocation
+
+		// maxParallelism is the global cap of the functions of a task
+		maxParallelism int
+
+		// waiting holds the functions wanted by the
+		// tasks of each team waiting in the queue
+		waiting map[string]int
+		mu      sync.Mutex
+	}
+
+	// allocation holds the functions given to a task along with the
+	// minimum it needs and its priority, used to choose the tasks preempted.
+	// Tasks paused by a preemption keep the functions they had
+	// so they can be resumed with them once they are free
+	allocation struct {
+		functions int
+		min       int
+		priority  int
+		preempted bool
+		previous  int
+
+		// team of the task and the functions it asked for
+		team   string
+		demand int
+	}
+
+	// preemption is the action taken on a running task to
+	// free its functions for a task of higher priority
+	preemption struct {
+		taskId      string
+		action      string
+		parallelism int
+	}
+
+	// admitResult tells whether a task was admitted, or why it has to wait
+	admitResult int
+)
+
+const (
+	admitted admitResult = iota
+	// the minimum parallelism of the task does not fit in the budget
+	waitBudget
+	// the team of the task is using its fair share of the budget
+	waitShare
+)
+
+func makeAdmission(budget int, shares map[string]float64, maxParallelism int) *admission {
+	return &admission{
+		budget:         budget,
+		shares:         shares,
+		allocations:    make(map[string]*allocation),
+		waiting:        make(map[string]int),
+		maxParallelism: maxParallelism,
+	}
+}
+
+// wantedParallelism returns the functions a new task asks for
+func (a *admission) wantedParallelism(task *api.TrainTask) int {
+	return clampParallelism(task, task.Parameters.Options.DefaultParallelism, a.maxParallelism)
+}
+
+// priorityOf returns the priority of a task as a number, higher
+// numbers having more priority. Tasks have normal priority by default
+func priorityOf(task *api.TrainTask) int {
+	switch task.Parameters.Priority {
+	case api.PriorityLow:
+		return 0
+	case api.PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// free returns the functions of the budget not allocated to any task
+// other than the given one. It must be called with the lock held
+func (a *admission) free(exclude string) int {
+	used := 0
+	for id, alloc := range a.allocations {
+		if id != exclude {
+			used += alloc.functions
+		}
+	}
+	return a.budget - used
+}
+
+// teamLeft returns the functions a team can still use without going over its
+// fair share, not counting the given task. It must be called with the lock held
+func (a *admission) teamLeft(team, exclude string) int {
+	demands := make(map[string]int, len(a.waiting))
+	for t, n := range a.waiting {
+		demands[t] = n
+	}
+
+	used := 0
+	for id, alloc := range a.allocations {
+		demand := alloc.demand
+		if alloc.functions > demand {
+			demand = alloc.functions
+		}
+		demands[alloc.team] += demand
+
+		if alloc.team == team && id != exclude {
+			used += alloc.functions
+		}
+	}
+
+	return fairShares(a.budget, demands, a.shares)[team] - used
+}
+
+// teamRunning returns true if the team has tasks with functions
+// allocated. It must be called with the lock held
+func (a *admission) teamRunning(team string) bool {
+	for _, alloc := range a.allocations {
+		if alloc.team == team && alloc.functions > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue adds the functions wanted by a submitted
+// task to the demand of its team
+func (a *admission) enqueue(task *api.TrainTask) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.waiting[teamOf(task)] += a.wantedParallelism(task)
+}
+
+// dequeue removes the functions wanted by a task canceled
+// while waiting in the queue from the demand of its team
+func (a *admission) dequeue(task *api.TrainTask) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	team := teamOf(task)
+	a.waiting[team] -= a.wantedParallelism(task)
+	if a.waiting[team] <= 0 {
+		delete(a.waiting, team)
+	}
+}
+
+// admit allocates functions to a new task if at least its minimum
+// parallelism fits in the budget, giving it at most its default parallelism
+// and what is left of the fair share of its team. A team can always run
+// one task with its minimum parallelism even if it goes over its share
+func (a *admission) admit(task *api.TrainTask) admitResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.admitLocked(task)
+}
+
+// admitLocked admits the task as admit does. It must be called with the lock held
+func (a *admission) admitLocked(task *api.TrainTask) admitResult {
+	id, team := task.Job.JobId, teamOf(task)
+	want, min := a.wantedParallelism(task), minParallelism(task)
+
+	if a.budget > 0 {
+		free := a.free(id)
+		if free < min {
+			return waitBudget
+		}
+		if want > free {
+			want = free
+		}
+
+		if left := a.teamLeft(team, id); want > left {
+			want = left
+			if want < min {
+				if a.teamRunning(team) {
+					return waitShare
+				}
+				want = min
+			}
+		}
+	}
+
+	a.waiting[team] -= a.wantedParallelism(task)
+	if a.waiting[team] <= 0 {
+		delete(a.waiting, team)
+	}
+
+	a.allocations[id] = &allocation{
+		functions: want,
+		min:       min,
+		priority:  priorityOf(task),
+		team:      team,
+		demand:    a.wantedParallelism(task),
+	}
+	return admitted
+}
+
+// admitPreempting admits a task, preempting the running tasks of lower
+// priority if its minimum parallelism does not fit in the budget. The
+// preemption is only kept if the task is admitted after it, otherwise the
+// preempted tasks get back their functions and no actions are returned
+func (a *admission) admitPreempting(task *api.TrainTask) (admitResult, []preemption) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := a.admitLocked(task)
+	if result != waitBudget {
+		return result, nil
+	}
+
+	saved := make(map[string]allocation, len(a.allocations))
+	for id, alloc := range a.allocations {
+		saved[id] = *alloc
+	}
+
+	actions := a.preempt(task)
+	if len(actions) == 0 {
+		return result, nil
+	}
+
+	if result = a.admitLocked(task); result != admitted {
+		for id, alloc := range saved {
+			*a.allocations[id] = alloc
+		}
+		return result, nil
+	}
+	return result, actions
+}
+
+// preempt plans the preemption of the running tasks of lower priority so
+// the minimum parallelism of the task fits in the budget. The tasks of lowest
+// priority are scaled down to their minimum parallelism first, and only if that
+// is not enough they are paused. The functions of the preempted tasks are
+// released right away. If the task does not fit even after pausing all of them,
+// nothing is preempted and nil is returned. It must be called with the lock held
+func (a *admission) preempt(task *api.TrainTask) []preemption {
+	if a.budget <= 0 {
+		return nil
+	}
+
+	need := minParallelism(task) - a.free(task.Job.JobId)
+	if need <= 0 {
+		return nil
+	}
+
+	// running tasks of lower priority, the lowest ones first
+	priority := priorityOf(task)
+	var victims []string
+	reclaimable := 0
+	for id, alloc := range a.allocations {
+		if alloc.priority < priority && alloc.functions > 0 {
+			victims = append(victims, id)
+			reclaimable += alloc.functions
+		}
+	}
+	if reclaimable < need {
+		return nil
+	}
+	sort.Slice(victims, func(i, j int) bool {
+		pi, pj := a.allocations[victims[i]].priority, a.allocations[victims[j]].priority
+		if pi != pj {
+			return pi < pj
+		}
+		return victims[i] < victims[j]
+	})
+
+	var actions []preemption
+	for _, id := range victims {
+		alloc := a.allocations[id]
+		if extra := alloc.functions - alloc.min; extra > 0 {
+			alloc.functions = alloc.min
+			need -= extra
+			actions = append(actions, preemption{taskId: id, action: api.PreemptScaleDown, parallelism: alloc.min})
+		}
+		if need <= 0 {
+			return actions
+		}
+	}
+
+	for _, id := range victims {
+		alloc := a.allocations[id]
+		need -= alloc.functions
+		alloc.preempted = true
+		alloc.previous = alloc.functions
+		alloc.functions = 0
+		actions = append(actions, preemption{taskId: id, action: api.PreemptPause})
+		if need <= 0 {
+			break
+		}
+	}
+
+	return actions
+}
+
+// resumable allocates again the functions of the tasks paused by a
+// preemption that have at least the given priority, as long as their
+// minimum parallelism fits. Returns the ids of the tasks to be resumed
+func (a *admission) resumable(priority int) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var ids []string
+	for id, alloc := range a.allocations {
+		if alloc.preempted && alloc.priority >= priority {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		pi, pj := a.allocations[ids[i]].priority, a.allocations[ids[j]].priority
+		if pi != pj {
+			return pi > pj
+		}
+		return ids[i] < ids[j]
+	})
+
+	var resumed []string
+	for _, id := range ids {
+		alloc := a.allocations[id]
+		want := alloc.previous
+		if a.budget > 0 {
+			free := a.free(id)
+			if free < alloc.min {
+				continue
+			}
+			if want > free {
+				want = free
+			}
+		}
+
+		alloc.functions = want
+		alloc.preempted = false
+		resumed = append(resumed, id)
+	}
+
+	return resumed
+}
+
+// repreempt marks a task whose resume failed as preempted again
+func (a *admission) repreempt(taskId string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if alloc, exists := a.allocations[taskId]; exists {
+		alloc.preempted = true
+		alloc.functions = 0
+	}
+}
+
+// isPreempted returns true if the task was paused by a preemption
+// and was not resumed yet
+func (a *admission) isPreempted(taskId string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alloc, exists := a.allocations[taskId]
+	return exists && alloc.preempted
+}
+
+// allocation returns the functions allocated to a task
+func (a *admission) allocation(taskId string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if alloc, exists := a.allocations[taskId]; exists {
+		return alloc.functions
+	}
+	return 0
+}
+
+// resize changes the allocation of a running task to the parallelism asked
+// by the policy, limited by the functions left free by the rest of the tasks.
+// The task always keeps its minimum parallelism. Returns the parallelism given
+func (a *admission) resize(task *api.TrainTask, parallelism int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// the task is about to be paused, so no functions are allocated
+	// and it keeps the parallelism it will resume with
+	id, team := task.Job.JobId, teamOf(task)
+	if alloc, exists := a.allocations[id]; exists && alloc.preempted {
+		alloc.demand = parallelism
+		return alloc.previous
+	}
+
+	demand := parallelism
+	if a.budget > 0 {
+		if free := a.free(id); parallelism > free {
+			parallelism = free
+		}
+		if left := a.teamLeft(team, id); parallelism > left {
+			parallelism = left
+		}
+	}
+	if min := minParallelism(task); parallelism < min {
+		parallelism = min
+	}
+
+	a.allocations[id] = &allocation{
+		functions: parallelism,
+		min:       minParallelism(task),
+		priority:  priorityOf(task),
+		team:      team,
+		demand:    demand,
+	}
+	return parallelism
+}
+
+// resume allocates functions to a paused task that resumes, at most the
+// given parallelism and limited by the budget and the fair share of its team
+// as when admitting a task. Tasks resumed by the scheduler already have their
+// functions allocated and keep them. If the minimum parallelism of the task
+// does not fit, it is marked as preempted so it is resumed once it fits,
+// and false is returned
+func (a *admission) resume(task *api.TrainTask, parallelism int) (int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, team := task.Job.JobId, teamOf(task)
+	alloc, exists := a.allocations[id]
+	if !exists {
+		alloc = &allocation{
+			min:      minParallelism(task),
+			priority: priorityOf(task),
+			team:     team,
+			demand:   parallelism,
+		}
+		a.allocations[id] = alloc
+	}
+	if alloc.functions > 0 && !alloc.preempted {
+		return alloc.functions, true
+	}
+
+	want := parallelism
+	if want < alloc.min {
+		want = alloc.min
+	}
+	if a.budget > 0 {
+		free := a.free(id)
+		if want > free {
+			want = free
+		}
+		if left := a.teamLeft(alloc.team, id); want > left {
+			want = left
+			if want < alloc.min && free >= alloc.min && !a.teamRunning(alloc.team) {
+				want = alloc.min
+			}
+		}
+
+		if want < alloc.min {
+			alloc.preempted = true
+			alloc.previous = parallelism
+			alloc.functions = 0
+			return 0, false
+		}
+	}
+
+	alloc.functions = want
+	alloc.preempted = false
+	return want, true
+}
+
+// restore sets the allocation of a running task after a restart of the
+// scheduler, with the functions it had when its state was last saved
+func (a *admission) restore(task *api.TrainTask, functions int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.allocations[task.Job.JobId] = &allocation{
+		functions: functions,
+		min:       minParallelism(task),
+		priority:  priorityOf(task),
+		team:      teamOf(task),
+		demand:    functions,
+	}
+}
+
+// suspend frees the functions of a paused task, keeping
+// its priority and minimum parallelism for when it resumes
+func (a *admission) suspend(taskId string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if alloc, exists := a.allocations[taskId]; exists {
+		alloc.functions = 0
+	}
+}
+
+// release forgets a finished task and frees its functions
+func (a *admission) release(taskId string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.allocations, taskId)
+}
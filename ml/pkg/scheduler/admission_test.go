@@ -0,0 +1,362 @@
+package scheduler
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"reflect"
+	"testing"
+)
+
+// running is a task with functions allocated when the test starts
+type running struct {
+	id        string
+	team      string
+	priority  int
+	functions int
+	min       int
+	demand    int
+}
+
+func makeTestAdmission(budget int, shares map[string]float64, tasks []running) *admission {
+	a := makeAdmission(budget, shares, 0)
+	for _, r := range tasks {
+		demand := r.demand
+		if demand == 0 {
+			demand = r.functions
+		}
+		a.allocations[r.id] = &allocation{
+			functions: r.functions,
+			min:       r.min,
+			priority:  r.priority,
+			team:      r.team,
+			demand:    demand,
+		}
+	}
+	return a
+}
+
+func makeTeamTask(id, team, priority string, parallelism, min int) *api.TrainTask {
+	task := makeTask(id, priority)
+	task.Parameters.Team = team
+	task.Parameters.Options.DefaultParallelism = parallelism
+	task.Parameters.Options.MinParallelism = min
+	return task
+}
+
+func TestAdmit(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    int
+		shares    map[string]float64
+		running   []running
+		waiting   []*api.TrainTask
+		task      *api.TrainTask
+		want      admitResult
+		functions int
+	}{
+		{
+			name:      "no budget",
+			budget:    0,
+			running:   []running{{id: "x", team: "a", functions: 50, min: 1}},
+			task:      makeTeamTask("t", "a", "", 4, 1),
+			want:      admitted,
+			functions: 4,
+		},
+		{
+			name:      "fits",
+			budget:    10,
+			task:      makeTeamTask("t", "a", "", 4, 1),
+			want:      admitted,
+			functions: 4,
+		},
+		{
+			name:      "limited by the free functions",
+			budget:    10,
+			running:   []running{{id: "x", team: "a", functions: 8, min: 1}},
+			task:      makeTeamTask("t", "a", "", 4, 1),
+			want:      admitted,
+			functions: 2,
+		},
+		{
+			name:    "minimum does not fit",
+			budget:  10,
+			running: []running{{id: "x", team: "a", functions: 8, min: 1}},
+			task:    makeTeamTask("t", "a", "", 4, 3),
+			want:    waitBudget,
+		},
+		{
+			name:    "team over its share",
+			budget:  10,
+			running: []running{{id: "x", team: "a", functions: 5, min: 1}},
+			waiting: []*api.TrainTask{makeTeamTask("y", "b", "", 5, 1)},
+			task:    makeTeamTask("t", "a", "", 4, 1),
+			want:    waitShare,
+		},
+		{
+			name:      "limited by the share",
+			budget:    10,
+			running:   []running{{id: "x", team: "a", functions: 2, min: 1}},
+			waiting:   []*api.TrainTask{makeTeamTask("y", "b", "", 8, 1)},
+			task:      makeTeamTask("t", "a", "", 6, 1),
+			want:      admitted,
+			functions: 3,
+		},
+		{
+			name:      "team without tasks gets its minimum",
+			budget:    10,
+			shares:    map[string]float64{"a": 100},
+			running:   []running{{id: "x", team: "a", functions: 5, min: 1, demand: 100}},
+			task:      makeTeamTask("t", "b", "", 4, 2),
+			want:      admitted,
+			functions: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := makeTestAdmission(tt.budget, tt.shares, tt.running)
+			for _, task := range tt.waiting {
+				a.enqueue(task)
+			}
+			a.enqueue(tt.task)
+
+			if got := a.admit(tt.task); got != tt.want {
+				t.Fatalf("got result %v, want %v", got, tt.want)
+			}
+			if got := a.allocation(tt.task.Job.JobId); got != tt.functions {
+				t.Errorf("got %v functions, want %v", got, tt.functions)
+			}
+		})
+	}
+}
+
+func TestAdmitPreempting(t *testing.T) {
+	tests := []struct {
+		name      string
+		running   []running
+		task      *api.TrainTask
+		want      admitResult
+		actions   []preemption
+		functions map[string]int
+	}{
+		{
+			name: "scale down the lowest priority",
+			running: []running{
+				{id: "low", team: "a", priority: 0, functions: 6, min: 2},
+				{id: "normal", team: "a", priority: 1, functions: 4, min: 1},
+			},
+			task: makeTeamTask("t", "a", api.PriorityHigh, 5, 3),
+			want: admitted,
+			actions: []preemption{
+				{taskId: "low", action: api.PreemptScaleDown, parallelism: 2},
+			},
+			functions: map[string]int{"low": 2, "normal": 4, "t": 4},
+		},
+		{
+			name: "pause when scaling down is not enough",
+			running: []running{
+				{id: "low", team: "a", priority: 0, functions: 2, min: 2},
+				{id: "normal", team: "a", priority: 1, functions: 8, min: 8},
+			},
+			task: makeTeamTask("t", "a", api.PriorityHigh, 4, 4),
+			want: admitted,
+			actions: []preemption{
+				{taskId: "low", action: api.PreemptPause},
+				{taskId: "normal", action: api.PreemptPause},
+			},
+			functions: map[string]int{"low": 0, "normal": 0, "t": 4},
+		},
+		{
+			name: "no tasks of lower priority",
+			running: []running{
+				{id: "x", team: "a", priority: 1, functions: 10, min: 1},
+			},
+			task:      makeTeamTask("t", "a", api.PriorityNormal, 4, 1),
+			want:      waitBudget,
+			functions: map[string]int{"x": 10, "t": 0},
+		},
+		{
+			name: "not enough functions to reclaim",
+			running: []running{
+				{id: "low", team: "a", priority: 0, functions: 2, min: 1},
+				{id: "x", team: "a", priority: 2, functions: 8, min: 1},
+			},
+			task:      makeTeamTask("t", "a", api.PriorityHigh, 4, 4),
+			want:      waitBudget,
+			functions: map[string]int{"low": 2, "x": 8, "t": 0},
+		},
+		{
+			name: "rolled back when the task is still not admitted",
+			running: []running{
+				{id: "b", team: "b", priority: 2, functions: 2, min: 2},
+				{id: "low", team: "a", priority: 0, functions: 8, min: 1},
+			},
+			task:      makeTeamTask("t", "b", api.PriorityHigh, 2, 2),
+			want:      waitShare,
+			functions: map[string]int{"b": 2, "low": 8, "t": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := makeTestAdmission(10, nil, tt.running)
+
+			got, actions := a.admitPreempting(tt.task)
+			if got != tt.want {
+				t.Fatalf("got result %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(actions, tt.actions) {
+				t.Errorf("got actions %v, want %v", actions, tt.actions)
+			}
+			for id, functions := range tt.functions {
+				if got := a.allocation(id); got != functions {
+					t.Errorf("task %v got %v functions, want %v", id, got, functions)
+				}
+			}
+			for _, action := range tt.actions {
+				if paused := action.action == api.PreemptPause; a.isPreempted(action.taskId) != paused {
+					t.Errorf("task %v preempted is %v, want %v", action.taskId, !paused, paused)
+				}
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		budget      int
+		shares      map[string]float64
+		running     []running
+		waiting     []*api.TrainTask
+		task        *api.TrainTask
+		parallelism int
+		want        int
+		resumed     bool
+	}{
+		{
+			name:        "no budget",
+			task:        makeTeamTask("t", "a", "", 4, 1),
+			parallelism: 6,
+			want:        6,
+			resumed:     true,
+		},
+		{
+			name:        "keeps the functions given by the scheduler",
+			budget:      10,
+			running:     []running{{id: "t", team: "a", functions: 3, min: 1}},
+			task:        makeTeamTask("t", "a", "", 4, 1),
+			parallelism: 6,
+			want:        3,
+			resumed:     true,
+		},
+		{
+			name:        "limited by the free functions",
+			budget:      10,
+			running:     []running{{id: "x", team: "a", functions: 6, min: 1}},
+			task:        makeTeamTask("t", "a", "", 4, 1),
+			parallelism: 6,
+			want:        4,
+			resumed:     true,
+		},
+		{
+			name:        "minimum does not fit",
+			budget:      10,
+			running:     []running{{id: "x", team: "a", functions: 9, min: 1}},
+			task:        makeTeamTask("t", "a", "", 4, 2),
+			parallelism: 4,
+		},
+		{
+			name:        "team over its share",
+			budget:      10,
+			running:     []running{{id: "x", team: "a", functions: 5, min: 1}},
+			waiting:     []*api.TrainTask{makeTeamTask("y", "b", "", 5, 1)},
+			task:        makeTeamTask("t", "a", "", 4, 1),
+			parallelism: 4,
+		},
+		{
+			name:        "team without tasks gets its minimum",
+			budget:      10,
+			shares:      map[string]float64{"a": 100},
+			running:     []running{{id: "x", team: "a", functions: 5, min: 1, demand: 100}},
+			task:        makeTeamTask("t", "b", "", 4, 2),
+			parallelism: 4,
+			want:        2,
+			resumed:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := makeTestAdmission(tt.budget, tt.shares, tt.running)
+			for _, task := range tt.waiting {
+				a.enqueue(task)
+			}
+
+			got, resumed := a.resume(tt.task, tt.parallelism)
+			if got != tt.want || resumed != tt.resumed {
+				t.Fatalf("got %v, %v, want %v, %v", got, resumed, tt.want, tt.resumed)
+			}
+
+			// a task that does not fit waits to be resumed by the scheduler
+			id := tt.task.Job.JobId
+			if a.isPreempted(id) == tt.resumed {
+				t.Errorf("task preempted is %v, want %v", !tt.resumed, tt.resumed)
+			}
+			if !tt.resumed && a.allocations[id].previous != tt.parallelism {
+				t.Errorf("task resumes with %v functions, want %v", a.allocations[id].previous, tt.parallelism)
+			}
+		})
+	}
+}
+
+func TestResumable(t *testing.T) {
+	a := makeTestAdmission(10, nil, []running{
+		{id: "x", team: "a", priority: 2, functions: 5, min: 1},
+	})
+	for id, priority := range map[string]int{"low": 0, "normal": 1, "normal2": 1} {
+		a.allocations[id] = &allocation{min: 2, priority: priority, team: "a", preempted: true, previous: 4}
+	}
+
+	// only the tasks with at least the priority of the queue are resumed,
+	// the ones of higher priority first and as long as their minimum fits
+	if got, want := a.resumable(1), []string{"normal"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got resumed %v, want %v", got, want)
+	}
+	if got := a.allocation("normal"); got != 4 {
+		t.Errorf("got %v functions, want 4", got)
+	}
+	if !a.isPreempted("normal2") || !a.isPreempted("low") {
+		t.Error("tasks that do not fit should stay preempted")
+	}
+
+	// a failed resume pauses the task again
+	a.repreempt("normal")
+	a.release("x")
+	if got, want := a.resumable(0), []string{"normal", "normal2", "low"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got resumed %v, want %v", got, want)
+	}
+	if got := a.allocation("low"); got != 2 {
+		t.Errorf("got %v functions, want 2", got)
+	}
+}
+
+func TestEnqueueDequeue(t *testing.T) {
+	a := makeAdmission(10, nil, 0)
+	first := makeTeamTask("t1", "a", "", 4, 1)
+	second := makeTeamTask("t2", "a", "", 3, 1)
+
+	a.enqueue(first)
+	a.enqueue(second)
+	if got := a.waiting["a"]; got != 7 {
+		t.Fatalf("got demand %v, want 7", got)
+	}
+
+	a.dequeue(first)
+	if got := a.waiting["a"]; got != 3 {
+		t.Errorf("got demand %v, want 3", got)
+	}
+	a.dequeue(second)
+	if _, exists := a.waiting["a"]; exists {
+		t.Error("team without waiting tasks should have no demand")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/diegostock12/kubeml/ml/pkg/api"
 )
@@ -67,7 +68,14 @@ func (s *Scheduler) newParallelism(w http.ResponseWriter, r *http.Request) {
 	s.logger.Debug("Received request for new parallelism",
 		zap.Any("task", task))
 
-	// Add the request to scheduler queue
+	// Add the request to scheduler queue, saving it
+	// first so it is not lost if the scheduler restarts
+	s.persist(TaskRecord{
+		Task:      task,
+		Started:   true,
+		Pending:   true,
+		Functions: s.admission.allocation(task.Job.JobId),
+	})
 	s.queue.pushTask(&task)
 
 	w.WriteHeader(http.StatusOK)
@@ -93,10 +101,14 @@ func (s *Scheduler) train(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the jobId and push to queue
-	id := createJobId()
+	if !s.policy.exists(req.Options.Policy) {
+		http.Error(w, fmt.Sprintf("unknown scheduling policy \"%v\"", req.Options.Policy), http.StatusBadRequest)
+		return
+	}
 
-	// TODO now add it directly to the task queue
+	// Create the jobId and push to the waiting queue,
+	// from which it is admitted once there are enough functions
+	id := createJobId()
 	task := api.TrainTask{
 		Parameters: req,
 		Job: api.JobInfo{
@@ -106,7 +118,10 @@ func (s *Scheduler) train(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Debug("Adding task to queue",
 		zap.Any("task", task))
-	s.queue.pushTask(&task)
+	s.persist(TaskRecord{Task: task, Queued: true, Submitted: time.Now()})
+	s.admission.enqueue(&task)
+	s.queue.pushRequest(&task)
+	s.admitTasks()
 
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write([]byte(id))
@@ -170,11 +185,100 @@ func (s *Scheduler) taskFinished(w http.ResponseWriter, r *http.Request) {
 		zap.String("task", taskId))
 
 	s.policy.taskFinished(taskId)
+	s.admission.release(taskId)
+	s.forget(taskId)
+	s.admitTasks()
 
 	w.WriteHeader(http.StatusOK)
 	return
 }
 
+// taskPaused releases the functions of a paused task. The task keeps
+// its allocation, and gets functions again when it is resumed
+func (s *Scheduler) taskPaused(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskId := vars["taskId"]
+
+	s.logger.Debug("Releasing paused task",
+		zap.String("task", taskId))
+
+	s.policy.taskPaused(taskId)
+	s.admission.suspend(taskId)
+	s.admitTasks()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// taskResumed allocates again the functions of a resumed task, at most the
+// parallelism it had and what is left of the budget and the share of its team.
+// If its minimum parallelism does not fit, the task keeps waiting and is
+// resumed by the scheduler once enough functions are released
+func (s *Scheduler) taskResumed(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusInternalServerError)
+		return
+	}
+
+	var task api.TrainTask
+	if err := json.Unmarshal(body, &task); err != nil {
+		http.Error(w, "Failed to decode the request", http.StatusBadRequest)
+		return
+	}
+	task.Job.JobId = mux.Vars(r)["taskId"]
+
+	parallelism, resumed := s.admission.resume(&task, task.Job.State.Parallelism)
+	if !resumed {
+		s.logger.Debug("Not enough functions to resume task",
+			zap.String("task", task.Job.JobId))
+		http.Error(w, "not enough functions to resume the task", http.StatusConflict)
+		return
+	}
+
+	s.logger.Debug("Allocating resumed task",
+		zap.String("task", task.Job.JobId),
+		zap.Int("parallelism", parallelism))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.Itoa(parallelism)))
+}
+
+// listQueue returns the tasks waiting to be admitted in order
+func (s *Scheduler) listQueue(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.Marshal(s.queue.waiting())
+	if err != nil {
+		s.logger.Error("error marshalling queue", zap.Error(err))
+		http.Error(w, "error sending queue", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// cancelQueued removes a task waiting to be admitted from the queue,
+// returning not found if the task is not waiting
+func (s *Scheduler) cancelQueued(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskId := vars["taskId"]
+
+	task, exists := s.queue.removeRequest(taskId)
+	if !exists {
+		http.Error(w, "task is not queued", http.StatusNotFound)
+		return
+	}
+
+	s.logger.Debug("Canceled queued task", zap.String("task", taskId))
+	s.admission.dequeue(task)
+	s.forget(taskId)
+
+	// the canceled task may have been blocking the ones behind it
+	s.admitTasks()
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // Handle heartbeats from Kubernetes
 func (s *Scheduler) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
@@ -188,16 +292,21 @@ func (s *Scheduler) GetHandler() http.Handler {
 	r.HandleFunc("/infer", s.infer).Methods("POST")
 	r.HandleFunc("/health", s.handleHealth).Methods("GET")
 	r.HandleFunc("/finish/{taskId}", s.taskFinished).Methods("DELETE")
+	r.HandleFunc("/pause/{taskId}", s.taskPaused).Methods("POST")
+	r.HandleFunc("/resume/{taskId}", s.taskResumed).Methods("POST")
+	r.HandleFunc("/queue", s.listQueue).Methods("GET")
+	r.HandleFunc("/queue/{taskId}", s.cancelQueued).Methods("DELETE")
 	return r
 }
 
-// Expose the API
-func (s *Scheduler) Serve(port int) {
-	s.logger.Info("Starting scheduler api", zap.Int("port", port))
-	addr := fmt.Sprintf(":%v", port)
+// Expose the API, returns once the API is shut down
+func (s *Scheduler) Serve() {
+	s.logger.Info("Starting scheduler api", zap.String("addr", s.server.Addr))
 
 	// Train serving the endpoint
-	err := http.ListenAndServe(addr, s.GetHandler())
-	s.logger.Fatal("Scheduler API done", zap.Error(err))
+	err := s.server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		s.logger.Fatal("Scheduler API done", zap.Error(err))
+	}
 
 }
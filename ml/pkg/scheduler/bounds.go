@@ -0,0 +1,49 @@
+package scheduler
+
+import "github.com/diegostock12/kubeml/ml/pkg/api"
+
+// boundedPolicy wraps a scheduling policy so the parallelism it chooses
+// stays between the minimum and maximum parallelism of the task, and
+// under the global cap of the scheduler
+type boundedPolicy struct {
+	SchedulerPolicy
+	maxParallelism int
+}
+
+func (bp boundedPolicy) calculateParallelism(task api.TrainTask) (parallelism int, op TaskOperation) {
+	parallelism, op = bp.SchedulerPolicy.calculateParallelism(task)
+	return clampParallelism(&task, parallelism, bp.maxParallelism), op
+}
+
+// minParallelism returns the minimum number of functions a task needs to run
+func minParallelism(task *api.TrainTask) int {
+	if task.Parameters.Options.MinParallelism > 0 {
+		return task.Parameters.Options.MinParallelism
+	}
+	return 1
+}
+
+// maxParallelism returns the maximum number of functions of a task, the
+// lowest of its own limit and the global cap, or zero if there is no limit
+func maxParallelism(task *api.TrainTask, globalMax int) int {
+	max := task.Parameters.Options.MaxParallelism
+	if globalMax > 0 && (max <= 0 || max > globalMax) {
+		max = globalMax
+	}
+	if max < 0 {
+		return 0
+	}
+	return max
+}
+
+// clampParallelism keeps the parallelism within the bounds of the task.
+// If the bounds conflict, the minimum parallelism wins so the task can run
+func clampParallelism(task *api.TrainTask, parallelism, globalMax int) int {
+	if max := maxParallelism(task, globalMax); max > 0 && parallelism > max {
+		parallelism = max
+	}
+	if min := minParallelism(task); parallelism < min {
+		parallelism = min
+	}
+	return parallelism
+}
@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"testing"
+)
+
+func TestClampParallelism(t *testing.T) {
+	tests := []struct {
+		name        string
+		min         int
+		max         int
+		globalMax   int
+		parallelism int
+		want        int
+	}{
+		{name: "no bounds", parallelism: 50, want: 50},
+		{name: "at least one", parallelism: 0, want: 1},
+		{name: "task minimum", min: 4, parallelism: 2, want: 4},
+		{name: "task maximum", max: 8, parallelism: 10, want: 8},
+		{name: "global maximum", globalMax: 6, parallelism: 10, want: 6},
+		{name: "lowest maximum", max: 8, globalMax: 6, parallelism: 10, want: 6},
+		{name: "task maximum under the global one", max: 4, globalMax: 6, parallelism: 10, want: 4},
+		{name: "within bounds", min: 2, max: 8, parallelism: 5, want: 5},
+		{name: "minimum over maximum", min: 8, max: 4, parallelism: 6, want: 8},
+		{name: "minimum over global maximum", min: 8, globalMax: 4, parallelism: 10, want: 8},
+		{name: "negative maximum", max: -1, parallelism: 10, want: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &api.TrainTask{Parameters: api.TrainRequest{Options: api.TrainOptions{
+				MinParallelism: tt.min,
+				MaxParallelism: tt.max,
+			}}}
+			if got := clampParallelism(task, tt.parallelism, tt.globalMax); got != tt.want {
+				t.Errorf("got parallelism %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
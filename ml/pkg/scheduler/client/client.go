@@ -8,6 +8,7 @@ import (
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -59,10 +60,123 @@ func (c *Client) FinishJob(jobId string) error {
 		return errors.Wrap(err, "could not send finish job request")
 	}
 
-	_, err = c.httpClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "error performing finish request")
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.Wrap(err, "could not read response body")
+		}
+		return errors.New(string(body))
+	}
+	return nil
+}
+
+// PauseJob tells the scheduler that a job is paused so
+// the resources assigned to it are released
+func (c *Client) PauseJob(jobId string) error {
+	url := c.schedulerUrl + "/pause/" + jobId
+
+	resp, err := c.httpClient.Post(url, "text/plain", nil)
+	if err != nil {
+		return errors.Wrap(err, "error performing pause request")
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// ResumeJob asks the scheduler to resume a paused job with the parallelism
+// in its state. It returns the parallelism given by the scheduler, or zero
+// if the functions are not available and the job has to keep waiting
+func (c *Client) ResumeJob(task *api.TrainTask) (int, error) {
+	url := c.schedulerUrl + "/resume/" + task.Job.JobId
+
+	body, err := json.Marshal(task)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not marshal json")
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "error performing resume request")
+	}
+	defer resp.Body.Close()
+
+	res, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not read response body")
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		parallelism, err := strconv.Atoi(strings.TrimSpace(string(res)))
+		if err != nil {
+			return 0, errors.Wrap(err, "could not parse parallelism")
+		}
+		return parallelism, nil
+	case http.StatusConflict:
+		return 0, nil
+	default:
+		return 0, errors.New(string(res))
+	}
+}
+
+// Queue returns the tasks waiting to be admitted by the scheduler
+func (c *Client) Queue() ([]api.TrainTask, error) {
+	url := c.schedulerUrl + "/queue"
+
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "error performing request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read response body")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(body))
+	}
+
+	var tasks []api.TrainTask
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal queue")
+	}
+
+	return tasks, nil
+}
+
+// CancelJob removes a job that is waiting to be admitted from
+// the queue of the scheduler, failing if the job is not queued
+func (c *Client) CancelJob(jobId string) error {
+	url := c.schedulerUrl + "/queue/" + jobId
+
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not create request")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error performing cancel request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.Wrap(err, "could not read response body")
+		}
+		return errors.New(string(body))
+	}
+
 	return nil
 }
 
@@ -106,17 +220,20 @@ func (c *Client) SubmitInferenceTask(req []byte) ([]byte, error) {
 func (c *Client) sendTask(body []byte, url string) (string, error) {
 
 	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(body))
-	defer resp.Body.Close()
-
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 
 	id, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(string(id))
+	}
+
 	return string(id), nil
 
 }
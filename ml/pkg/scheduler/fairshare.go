@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultTeam groups the tasks submitted without a team or an owner
+const defaultTeam = "default"
+
+// teamOf returns the team a task is accounted to. Tasks without
+// a team are accounted to their owner, so each user gets a share
+func teamOf(task *api.TrainTask) string {
+	switch {
+	case task.Parameters.Team != "":
+		return task.Parameters.Team
+	case task.Parameters.Owner != "":
+		return task.Parameters.Owner
+	default:
+		return defaultTeam
+	}
+}
+
+// ParseTeamShares parses the weights of the teams in the fair share,
+// given as a comma separated list such as "vision=2,nlp=1"
+func ParseTeamShares(s string) (map[string]float64, error) {
+	shares := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid team share \"%v\"", pair)
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || weight <= 0 {
+			return nil, errors.Errorf("invalid weight for team \"%v\"", parts[0])
+		}
+		shares[strings.TrimSpace(parts[0])] = weight
+	}
+
+	return shares, nil
+}
+
+// fairShares splits the budget among the teams with weighted max-min fairness.
+// Every team gets a part of the budget proportional to its weight, teams that
+// demand less than their part keep only what they demand and the rest is split
+// again among the others. Teams without a weight have a weight of one
+func fairShares(budget int, demands map[string]int, weights map[string]float64) map[string]int {
+	weightOf := func(team string) float64 {
+		if w, exists := weights[team]; exists {
+			return w
+		}
+		return 1
+	}
+
+	shares := make(map[string]int, len(demands))
+	var active []string
+	for team, demand := range demands {
+		if demand > 0 {
+			active = append(active, team)
+		}
+	}
+	sort.Strings(active)
+
+	remaining := budget
+	for len(active) > 0 && remaining > 0 {
+		var total float64
+		for _, team := range active {
+			total += weightOf(team)
+		}
+
+		// satisfy the teams that demand less than their part
+		var unsatisfied []string
+		available := remaining
+		for _, team := range active {
+			part := float64(available) * weightOf(team) / total
+			if float64(demands[team]-shares[team]) <= part {
+				remaining -= demands[team] - shares[team]
+				shares[team] = demands[team]
+			} else {
+				unsatisfied = append(unsatisfied, team)
+			}
+		}
+
+		// if every team wants more than its part, split
+		// what is left and give the remainder one by one
+		if len(unsatisfied) == len(active) {
+			given := 0
+			for _, team := range active {
+				part := int(float64(remaining) * weightOf(team) / total)
+				shares[team] += part
+				given += part
+			}
+			for i := 0; given < remaining; i++ {
+				shares[active[i%len(active)]]++
+				given++
+			}
+			break
+		}
+
+		active = unsatisfied
+	}
+
+	return shares
+}
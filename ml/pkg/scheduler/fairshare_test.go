@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFairShares(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  int
+		demands map[string]int
+		weights map[string]float64
+		want    map[string]int
+	}{
+		{
+			name:    "equal split",
+			budget:  10,
+			demands: map[string]int{"a": 10, "b": 10},
+			want:    map[string]int{"a": 5, "b": 5},
+		},
+		{
+			name:    "satisfied team",
+			budget:  10,
+			demands: map[string]int{"a": 2, "b": 10},
+			want:    map[string]int{"a": 2, "b": 8},
+		},
+		{
+			name:    "several rounds",
+			budget:  12,
+			demands: map[string]int{"a": 2, "b": 3, "c": 20},
+			want:    map[string]int{"a": 2, "b": 3, "c": 7},
+		},
+		{
+			name:    "weighted",
+			budget:  9,
+			demands: map[string]int{"vision": 20, "nlp": 20},
+			weights: map[string]float64{"vision": 2},
+			want:    map[string]int{"vision": 6, "nlp": 3},
+		},
+		{
+			name:    "weighted team satisfied",
+			budget:  12,
+			demands: map[string]int{"vision": 4, "nlp": 20},
+			weights: map[string]float64{"vision": 2, "nlp": 1},
+			want:    map[string]int{"vision": 4, "nlp": 8},
+		},
+		{
+			name:    "remainder",
+			budget:  10,
+			demands: map[string]int{"a": 10, "b": 10, "c": 10},
+			want:    map[string]int{"a": 4, "b": 3, "c": 3},
+		},
+		{
+			name:    "everyone satisfied",
+			budget:  10,
+			demands: map[string]int{"a": 2, "b": 3},
+			want:    map[string]int{"a": 2, "b": 3},
+		},
+		{
+			name:    "no demand",
+			budget:  10,
+			demands: map[string]int{"a": 0, "b": 3},
+			want:    map[string]int{"b": 3},
+		},
+		{
+			name:    "no budget",
+			budget:  0,
+			demands: map[string]int{"a": 3},
+			want:    map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fairShares(tt.budget, tt.demands, tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got shares %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTeamShares(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: map[string]float64{}},
+		{name: "teams", s: "vision=2, nlp=0.5", want: map[string]float64{"vision": 2, "nlp": 0.5}},
+		{name: "missing weight", s: "vision", wantErr: true},
+		{name: "zero weight", s: "vision=0", wantErr: true},
+		{name: "invalid weight", s: "vision=a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTeamShares(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got shares %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package scheduler
 
 import (
+	"encoding/json"
 	"github.com/diegostock12/kubeml/ml/pkg/api"
 	"go.uber.org/zap"
 	"sync"
 )
 
+// Default thresholds of the throughput based policy
 const (
 	ThroughPutScaleDownThreshold = 1.2
 	ThroughputScaleUpThreshold   = 1.05
@@ -19,6 +21,12 @@ type (
 		// calculate paralellism returns the parallelism for the next epoch
 		calculateParallelism(task api.TrainTask) (parallelism int, op TaskOperation)
 		taskFinished(taskId string)
+		taskPaused(taskId string)
+
+		// state returns the state kept about a task, if any, and restore
+		// sets it back once the scheduler is restarted
+		state(taskId string) (json.RawMessage, bool)
+		restore(taskId string, state json.RawMessage) error
 	}
 
 	ThroughputBasedPolicy struct {
@@ -30,14 +38,29 @@ type (
 		// increases or decreases
 		timeCache map[string]float64
 
+		// scaleUp and scaleDown are the ratios between the new and
+		// the reference time under which the parallelism is increased
+		// and over which it is decreased
+		scaleUp   float64
+		scaleDown float64
+
 		mu *sync.RWMutex
 	}
 )
 
-func makeThroughputPolicy(logger *zap.Logger) ThroughputBasedPolicy {
+func makeThroughputPolicy(logger *zap.Logger, scaleUp, scaleDown float64) ThroughputBasedPolicy {
+	if scaleUp <= 0 {
+		scaleUp = ThroughputScaleUpThreshold
+	}
+	if scaleDown <= 0 {
+		scaleDown = ThroughPutScaleDownThreshold
+	}
+
 	return ThroughputBasedPolicy{
 		logger:    logger.Named("throughput-policy"),
 		timeCache: make(map[string]float64),
+		scaleUp:   scaleUp,
+		scaleDown: scaleDown,
 		mu:        &sync.RWMutex{},
 	}
 }
@@ -48,17 +71,15 @@ func makeThroughputPolicy(logger *zap.Logger) ThroughputBasedPolicy {
 //
 // In between those thresholds the parallelism is kept untouched
 func (tp ThroughputBasedPolicy) calculateParallelism(task api.TrainTask) (parallelism int, op TaskOperation) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
 
-	tp.mu.RLock()
 	prevTime, exists := tp.timeCache[task.Job.JobId]
-	tp.mu.RUnlock()
 
 	// If it is the first epoch and we do not have a history
 	// of this task, simply return the debug parallelism
 	if !exists {
-		tp.mu.Lock()
 		tp.timeCache[task.Job.JobId] = 0
-		tp.mu.Unlock()
 
 		return task.Parameters.Options.DefaultParallelism, CreateTask
 
@@ -72,14 +93,14 @@ func (tp ThroughputBasedPolicy) calculateParallelism(task api.TrainTask) (parall
 
 		// If the new time is better than the prevTime
 		// always scale up and set a new reference time
-		case task.Job.State.ElapsedTime <= prevTime*ThroughputScaleUpThreshold:
+		case task.Job.State.ElapsedTime <= prevTime*tp.scaleUp:
 			tp.logger.Debug("Time is better, scaling up")
 			tp.timeCache[task.Job.JobId] = task.Job.State.ElapsedTime
 			return task.Job.State.Parallelism + 1, UpdateTask
 
 		// If the performance is much worse (20%) than the reference
 		// time, downscale and set a new reference time
-		case task.Job.State.ElapsedTime >= prevTime*ThroughPutScaleDownThreshold:
+		case task.Job.State.ElapsedTime >= prevTime*tp.scaleDown:
 			tp.logger.Debug("Time is worse, scaling down")
 			tp.timeCache[task.Job.JobId] = task.Job.State.ElapsedTime
 			return task.Job.State.Parallelism - 1, UpdateTask
@@ -93,6 +114,16 @@ func (tp ThroughputBasedPolicy) calculateParallelism(task api.TrainTask) (parall
 
 }
 
+// taskPaused forgets the reference time of the task, since the throughput
+// after resuming cannot be compared to the one before the pause
+func (tp ThroughputBasedPolicy) taskPaused(taskId string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if _, exists := tp.timeCache[taskId]; exists {
+		tp.timeCache[taskId] = 0
+	}
+}
+
 // taskFinished handles the finish of the task, here simply deletes it from
 // the time cache
 func (tp ThroughputBasedPolicy) taskFinished(taskId string) {
@@ -100,3 +131,323 @@ func (tp ThroughputBasedPolicy) taskFinished(taskId string) {
 	defer tp.mu.Unlock()
 	delete(tp.timeCache, taskId)
 }
+
+// state returns the reference time of the task
+func (tp ThroughputBasedPolicy) state(taskId string) (json.RawMessage, bool) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	prevTime, exists := tp.timeCache[taskId]
+	if !exists {
+		return nil, false
+	}
+	return marshalState(prevTime)
+}
+
+func (tp ThroughputBasedPolicy) restore(taskId string, state json.RawMessage) error {
+	var prevTime float64
+	if err := json.Unmarshal(state, &prevTime); err != nil {
+		return err
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.timeCache[taskId] = prevTime
+	return nil
+}
+
+// marshalState encodes the state of a task, which are
+// plain values that can always be marshalled
+func marshalState(v interface{}) (json.RawMessage, bool) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+type (
+	// StaticPolicy keeps the parallelism the task started with
+	StaticPolicy struct {
+		seen map[string]bool
+		mu   *sync.Mutex
+	}
+
+	// ConvergencePolicy adapts the parallelism to the slope of the train loss.
+	// While the loss keeps dropping quickly the parallelism is kept, once the
+	// relative improvement between epochs falls under the plateau threshold the
+	// parallelism is increased, since the larger global batch reduces the noise
+	// of the updates, and if the loss goes up the parallelism is decreased
+	ConvergencePolicy struct {
+		logger  *zap.Logger
+		plateau float64
+
+		// losses holds the train loss of the previous
+		// epoch of each task, or nil if it is unknown
+		losses map[string]*float64
+		mu     *sync.Mutex
+	}
+
+	// StepSearchPolicy probes the parallelism of a task in steps, first
+	// increasing it while the epochs get faster and then decreasing it,
+	// and keeps the fastest parallelism found for the rest of the training
+	StepSearchPolicy struct {
+		logger *zap.Logger
+		step   int
+
+		searches map[string]*stepSearch
+		mu       *sync.Mutex
+	}
+
+	// stepSearch is the state of the search of a task
+	stepSearch struct {
+		best      int
+		bestTime  float64
+		direction int
+		turned    bool
+		done      bool
+	}
+
+	// stepSearchState is the saved form of a stepSearch
+	stepSearchState struct {
+		Best      int     `json:"best"`
+		BestTime  float64 `json:"best_time"`
+		Direction int     `json:"direction"`
+		Turned    bool    `json:"turned"`
+		Done      bool    `json:"done"`
+	}
+)
+
+// Defaults of the convergence and step search policies
+const (
+	ConvergencePlateauThreshold = 0.02
+	StepSearchStep              = 1
+)
+
+func makeStaticPolicy() StaticPolicy {
+	return StaticPolicy{
+		seen: make(map[string]bool),
+		mu:   &sync.Mutex{},
+	}
+}
+
+// calculateParallelism for the static policy gives new tasks their
+// default parallelism and keeps it in the next epochs
+func (sp StaticPolicy) calculateParallelism(task api.TrainTask) (parallelism int, op TaskOperation) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if !sp.seen[task.Job.JobId] {
+		sp.seen[task.Job.JobId] = true
+		return task.Parameters.Options.DefaultParallelism, CreateTask
+	}
+	return task.Job.State.Parallelism, UpdateTask
+}
+
+func (sp StaticPolicy) taskPaused(taskId string) {}
+
+func (sp StaticPolicy) taskFinished(taskId string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	delete(sp.seen, taskId)
+}
+
+// state of the static policy only records that the task was seen
+func (sp StaticPolicy) state(taskId string) (json.RawMessage, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if !sp.seen[taskId] {
+		return nil, false
+	}
+	return marshalState(true)
+}
+
+func (sp StaticPolicy) restore(taskId string, state json.RawMessage) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.seen[taskId] = true
+	return nil
+}
+
+func makeConvergencePolicy(logger *zap.Logger) ConvergencePolicy {
+	return ConvergencePolicy{
+		logger:  logger.Named("convergence-policy"),
+		plateau: ConvergencePlateauThreshold,
+		losses:  make(map[string]*float64),
+		mu:      &sync.Mutex{},
+	}
+}
+
+// calculateParallelism for the convergence policy compares the train loss
+// of the last epoch with the one of the previous epoch
+func (cp ConvergencePolicy) calculateParallelism(task api.TrainTask) (parallelism int, op TaskOperation) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	prev, exists := cp.losses[task.Job.JobId]
+	if !exists {
+		cp.losses[task.Job.JobId] = nil
+		return task.Parameters.Options.DefaultParallelism, CreateTask
+	}
+
+	loss := task.Job.State.Loss
+	cp.losses[task.Job.JobId] = &loss
+
+	parallelism = task.Job.State.Parallelism
+	if prev == nil || *prev <= 0 {
+		cp.logger.Debug("No previous loss, keeping parallelism")
+		return parallelism, UpdateTask
+	}
+
+	slope := (*prev - loss) / *prev
+	switch {
+	case slope < 0:
+		cp.logger.Debug("Loss is increasing, scaling down", zap.Float64("slope", slope))
+		if parallelism > 1 {
+			parallelism--
+		}
+	case slope < cp.plateau:
+		cp.logger.Debug("Loss is reaching a plateau, scaling up", zap.Float64("slope", slope))
+		parallelism++
+	default:
+		cp.logger.Debug("Loss is dropping, keeping parallelism", zap.Float64("slope", slope))
+	}
+
+	return parallelism, UpdateTask
+}
+
+// taskPaused forgets the loss of the task, so the first epoch
+// after resuming is only used as the reference for the next one
+func (cp ConvergencePolicy) taskPaused(taskId string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if _, exists := cp.losses[taskId]; exists {
+		cp.losses[taskId] = nil
+	}
+}
+
+func (cp ConvergencePolicy) taskFinished(taskId string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	delete(cp.losses, taskId)
+}
+
+// state returns the loss of the previous epoch of the task, null if unknown
+func (cp ConvergencePolicy) state(taskId string) (json.RawMessage, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	loss, exists := cp.losses[taskId]
+	if !exists {
+		return nil, false
+	}
+	return marshalState(loss)
+}
+
+func (cp ConvergencePolicy) restore(taskId string, state json.RawMessage) error {
+	var loss *float64
+	if err := json.Unmarshal(state, &loss); err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.losses[taskId] = loss
+	return nil
+}
+
+func makeStepSearchPolicy(logger *zap.Logger) StepSearchPolicy {
+	return StepSearchPolicy{
+		logger:   logger.Named("step-search-policy"),
+		step:     StepSearchStep,
+		searches: make(map[string]*stepSearch),
+		mu:       &sync.Mutex{},
+	}
+}
+
+// calculateParallelism for the step search policy compares the time of the
+// last epoch with the fastest one so far. If the probed parallelism is faster
+// the search continues in the same direction, otherwise it turns around once
+// and finally settles on the fastest parallelism
+func (sp StepSearchPolicy) calculateParallelism(task api.TrainTask) (parallelism int, op TaskOperation) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	search, exists := sp.searches[task.Job.JobId]
+	if !exists {
+		sp.searches[task.Job.JobId] = &stepSearch{direction: 1}
+		return task.Parameters.Options.DefaultParallelism, CreateTask
+	}
+
+	if search.done {
+		return search.best, UpdateTask
+	}
+
+	elapsed := task.Job.State.ElapsedTime
+	switch {
+	case search.best == 0 || elapsed < search.bestTime:
+		search.best, search.bestTime = task.Job.State.Parallelism, elapsed
+	case !search.turned:
+		search.direction, search.turned = -search.direction, true
+	default:
+		search.done = true
+	}
+
+	next := search.best + search.direction*sp.step
+	if search.done || next < 1 {
+		search.done = true
+		sp.logger.Debug("Search finished",
+			zap.String("task", task.Job.JobId),
+			zap.Int("parallelism", search.best))
+		return search.best, UpdateTask
+	}
+
+	sp.logger.Debug("Probing parallelism",
+		zap.String("task", task.Job.JobId),
+		zap.Int("parallelism", next))
+	return next, UpdateTask
+}
+
+func (sp StepSearchPolicy) taskPaused(taskId string) {}
+
+func (sp StepSearchPolicy) taskFinished(taskId string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	delete(sp.searches, taskId)
+}
+
+func (sp StepSearchPolicy) state(taskId string) (json.RawMessage, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	search, exists := sp.searches[taskId]
+	if !exists {
+		return nil, false
+	}
+	return marshalState(stepSearchState{
+		Best:      search.best,
+		BestTime:  search.bestTime,
+		Direction: search.direction,
+		Turned:    search.turned,
+		Done:      search.done,
+	})
+}
+
+func (sp StepSearchPolicy) restore(taskId string, state json.RawMessage) error {
+	var s stepSearchState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return err
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.searches[taskId] = &stepSearch{
+		best:      s.Best,
+		bestTime:  s.BestTime,
+		direction: s.Direction,
+		turned:    s.Turned,
+		done:      s.Done,
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// epoch is the state sent by a task at the end of an epoch and the
+// parallelism the policy should give it, pause pauses the task before it
+type epoch struct {
+	pause       bool
+	parallelism int
+	loss        float64
+	elapsed     float64
+	want        int
+}
+
+// runPolicy sends the epochs of a task to the policy after creating it
+// with a default parallelism of 4, and checks the parallelism given
+func runPolicy(t *testing.T, policy SchedulerPolicy, epochs []epoch) {
+	task := makeTask("t", "")
+	task.Parameters.Options.DefaultParallelism = 4
+
+	if p, op := policy.calculateParallelism(*task); p != 4 || op != CreateTask {
+		t.Fatalf("got %v, %v for a new task, want 4, %v", p, op, CreateTask)
+	}
+
+	for i, e := range epochs {
+		if e.pause {
+			policy.taskPaused("t")
+		}
+		task.Job.State.Parallelism = e.parallelism
+		task.Job.State.Loss = e.loss
+		task.Job.State.ElapsedTime = e.elapsed
+
+		p, op := policy.calculateParallelism(*task)
+		if op != UpdateTask {
+			t.Errorf("epoch %v got operation %v, want %v", i, op, UpdateTask)
+		}
+		if p != e.want {
+			t.Errorf("epoch %v got parallelism %v, want %v", i, p, e.want)
+		}
+	}
+}
+
+func TestConvergencePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		epochs []epoch
+	}{
+		{
+			name:   "first epoch is the reference",
+			epochs: []epoch{{parallelism: 4, loss: 1, want: 4}},
+		},
+		{
+			name: "loss dropping",
+			epochs: []epoch{
+				{parallelism: 4, loss: 1, want: 4},
+				{parallelism: 4, loss: 0.5, want: 4},
+			},
+		},
+		{
+			name: "plateau",
+			epochs: []epoch{
+				{parallelism: 4, loss: 1, want: 4},
+				{parallelism: 4, loss: 0.99, want: 5},
+				{parallelism: 5, loss: 0.99, want: 6},
+			},
+		},
+		{
+			name: "loss increasing",
+			epochs: []epoch{
+				{parallelism: 4, loss: 1, want: 4},
+				{parallelism: 4, loss: 1.2, want: 3},
+			},
+		},
+		{
+			name: "loss increasing with one function",
+			epochs: []epoch{
+				{parallelism: 1, loss: 1, want: 1},
+				{parallelism: 1, loss: 1.2, want: 1},
+			},
+		},
+		{
+			name: "no previous loss",
+			epochs: []epoch{
+				{parallelism: 4, loss: 0, want: 4},
+				{parallelism: 4, loss: 0.99, want: 4},
+			},
+		},
+		{
+			name: "paused",
+			epochs: []epoch{
+				{parallelism: 4, loss: 1, want: 4},
+				{pause: true, parallelism: 4, loss: 0.99, want: 4},
+				{parallelism: 4, loss: 0.985, want: 5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runPolicy(t, makeConvergencePolicy(zap.NewNop()), tt.epochs)
+		})
+	}
+}
+
+func TestStepSearchPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		epochs []epoch
+	}{
+		{
+			name: "up until slower, then back down and done",
+			epochs: []epoch{
+				{parallelism: 4, elapsed: 10, want: 5},
+				{parallelism: 5, elapsed: 8, want: 6},
+				{parallelism: 6, elapsed: 9, want: 4},
+				{parallelism: 4, elapsed: 10, want: 5},
+				{parallelism: 5, elapsed: 8, want: 5},
+			},
+		},
+		{
+			name: "turns around and keeps going down",
+			epochs: []epoch{
+				{parallelism: 4, elapsed: 10, want: 5},
+				{parallelism: 5, elapsed: 12, want: 3},
+				{parallelism: 3, elapsed: 8, want: 2},
+				{parallelism: 2, elapsed: 9, want: 3},
+				{parallelism: 3, elapsed: 8, want: 3},
+			},
+		},
+		{
+			name: "does not go under one function",
+			epochs: []epoch{
+				{parallelism: 1, elapsed: 10, want: 2},
+				{parallelism: 2, elapsed: 12, want: 1},
+				{parallelism: 1, elapsed: 10, want: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runPolicy(t, makeStepSearchPolicy(zap.NewNop()), tt.epochs)
+		})
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	registry, err := makePolicyRegistry(zap.NewNop(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", api.PolicyStatic, api.PolicyThroughput, api.PolicyConvergence, api.PolicyStepSearch} {
+		if !registry.exists(name) {
+			t.Errorf("policy \"%v\" should exist", name)
+		}
+	}
+	if registry.exists("throughtput") {
+		t.Error("unknown policy should not exist")
+	}
+
+	if _, err := makePolicyRegistry(zap.NewNop(), Options{Policy: "other"}); err == nil {
+		t.Error("expected an error for an unknown default policy")
+	}
+}
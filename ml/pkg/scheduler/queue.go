@@ -1,83 +1,238 @@
 package scheduler
 
 import (
-	"container/list"
-	"fmt"
+	"container/heap"
 	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/pkg/errors"
+	"sort"
 	"sync"
 )
 
-// queue is the internal type used to queue
-// the elements in the scheduler
-type queue = list.List
+// errQueueClosed is returned when popping from a closed queue
+var errQueueClosed = errors.New("queue is closed")
 
-// SchedulerQueue is the queue that will be used for the scheduler
-type SchedulerQueue struct {
+type (
+	// queueItem is a task in the queue along with the
+	// values used to order it
+	queueItem struct {
+		task *api.TrainTask
 
-	// lock used to access the tasks in the queue
-	lock sync.RWMutex
+		// update is true for the requests of running tasks at the end of an
+		// epoch, which are served before the newly submitted tasks
+		update   bool
+		priority int
+		seq      uint64
+	}
+
+	// taskHeap is the heap used to order the tasks in the scheduler.
+	// Updates go first, then the tasks of higher priority, and tasks
+	// with the same priority are served in order of arrival
+	taskHeap []*queueItem
+
+	// SchedulerQueue is the queue that will be used for the scheduler
+	SchedulerQueue struct {
+
+		// lock used to access the tasks in the queue, and
+		// cond to wait for tasks in the training queue
+		lock sync.RWMutex
+		cond *sync.Cond
+
+		// trainQ holds the tasks that are running and have priority over the
+		// tasks that are submitted
+		trainQ taskHeap
+
+		// waitQ holds the tasks that are submitted but are still waiting
+		// cause there are not enough resources for them
+		waitQ taskHeap
+
+		// seq is the arrival number given to the next task
+		seq    uint64
+		closed bool
+	}
+)
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].update != h[j].update {
+		return h[i].update
+	}
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
 
-	// trainQ holds the tasks that are running and have priority over the
-	// tasks that are submitted
-	trainQ *queue
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*queueItem)) }
 
-	// waitQ holds the tasks that are submitted but are still waiting
-	// cause there are not enough resources for them TODO we need a way to check this
-	waitQ *queue
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// sorted returns the items of the heap in the order they would be popped
+func (h taskHeap) sorted() []*queueItem {
+	items := make(taskHeap, len(h))
+	copy(items, h)
+	sort.Slice(items, items.Less)
+	return items
 }
 
 // NewQueue creates a queue for the scheduler
-func NewQueue() SchedulerQueue {
-	return SchedulerQueue{
-		trainQ: list.New(),
-		waitQ:  list.New(),
+func NewQueue() *SchedulerQueue {
+	sq := &SchedulerQueue{}
+	sq.cond = sync.NewCond(&sq.lock)
+	return sq
+}
+
+// item wraps a task to be pushed in one of the heaps.
+// It must be called with the lock held
+func (sq *SchedulerQueue) item(task *api.TrainTask, update bool) *queueItem {
+	sq.seq++
+	return &queueItem{
+		task:     task,
+		update:   update,
+		priority: priorityOf(task),
+		seq:      sq.seq,
 	}
 }
 
-// pushTrainTask pushes the task so it can be analyzed
-// and given a new parallelism level
+// pushTrainTask pushes the request of a running task so it can be
+// analyzed and given a new parallelism level, waking up the scheduler
 func (sq *SchedulerQueue) pushTask(task *api.TrainTask) {
 	sq.lock.Lock()
 	defer sq.lock.Unlock()
 
-	// Insert a new TrainTask in the queue
-	sq.trainQ.PushBack(task)
+	heap.Push(&sq.trainQ, sq.item(task, true))
+	sq.cond.Signal()
+}
+
+// pushAdmitted pushes a task that was admitted but not started into
+// the training queue, once admitted or after a restart of the scheduler
+func (sq *SchedulerQueue) pushAdmitted(task *api.TrainTask) {
+	sq.lock.Lock()
+	defer sq.lock.Unlock()
 
+	heap.Push(&sq.trainQ, sq.item(task, false))
+	sq.cond.Signal()
 }
 
-// popTask returns the next element from the training queue
+// popTask returns the next element from the training queue, blocking
+// until there is one. Returns an error once the queue is closed
 func (sq *SchedulerQueue) popTask() (*api.TrainTask, error) {
 	sq.lock.Lock()
 	defer sq.lock.Unlock()
 
-	if sq.trainQ.Len() == 0 {
-		return nil, fmt.Errorf("queue is empty")
+	for len(sq.trainQ) == 0 && !sq.closed {
+		sq.cond.Wait()
+	}
+	if sq.closed {
+		return nil, errQueueClosed
+	}
+
+	return heap.Pop(&sq.trainQ).(*queueItem).task, nil
+}
+
+// Close closes the queue and wakes up the goroutines
+// waiting for tasks, which get an error instead
+func (sq *SchedulerQueue) Close() {
+	sq.lock.Lock()
+	defer sq.lock.Unlock()
+
+	sq.closed = true
+	sq.cond.Broadcast()
+}
+
+// pushRequest pushes a submitted task into the waiting queue, behind
+// the tasks of its same or higher priority
+func (sq *SchedulerQueue) pushRequest(task *api.TrainTask) {
+	sq.lock.Lock()
+	defer sq.lock.Unlock()
+
+	heap.Push(&sq.waitQ, sq.item(task, false))
+}
+
+// removeRequest removes a task from the waiting queue, returning
+// the task or false if it is not waiting
+func (sq *SchedulerQueue) removeRequest(taskId string) (*api.TrainTask, bool) {
+	sq.lock.Lock()
+	defer sq.lock.Unlock()
+
+	for i, item := range sq.waitQ {
+		if item.task.Job.JobId == taskId {
+			heap.Remove(&sq.waitQ, i)
+			return item.task, true
+		}
 	}
+	return nil, false
+}
 
-	// get the first element and remove it from the
-	// linked list
-	e := sq.trainQ.Front()
-	sq.trainQ.Remove(e)
+// headPriority returns the priority of the first waiting
+// task, or -1 if there are no tasks waiting
+func (sq *SchedulerQueue) headPriority() int {
+	sq.lock.RLock()
+	defer sq.lock.RUnlock()
 
-	// Return the value as a train task
-	return e.Value.(*api.TrainTask), nil
+	if len(sq.waitQ) == 0 {
+		return -1
+	}
+	return sq.waitQ[0].priority
 }
 
-// TODO how will the queues interact?
-// pushRequest pushes requests into the waiting request
-func (sq *SchedulerQueue) pushRequest(req *api.TrainRequest) {
+// admitRequests removes the waiting tasks from the queue in order of
+// priority and arrival as long as the admit function accepts them, and
+// returns them so they are pushed to the training queue with pushAdmitted.
+// It stops at the first task that does not fit in the budget so tasks are not
+// overtaken, but skips the tasks of teams that are using their fair share
+func (sq *SchedulerQueue) admitRequests(admit func(task *api.TrainTask) admitResult) []*api.TrainTask {
 	sq.lock.Lock()
 	defer sq.lock.Unlock()
 
-	//sq.waitQ.PushBack(req)
+	var admitted []*api.TrainTask
+	items := sq.waitQ.sorted()
+	remaining := items[:0:0]
+
+loop:
+	for i, item := range items {
+		switch admit(item.task) {
+		case waitBudget:
+			remaining = append(remaining, items[i:]...)
+			break loop
+		case waitShare:
+			remaining = append(remaining, item)
+			continue
+		}
+
+		admitted = append(admitted, item.task)
+	}
+
+	if len(admitted) > 0 {
+		sq.waitQ = remaining
+		heap.Init(&sq.waitQ)
+	}
+
+	return admitted
+}
 
-	// right now just create a task and push it to queue
-	t := &api.TrainTask{
-		Parameters: *req,
-		Job: api.JobInfo{
-			JobId: createJobId(),
-		},
+// waiting returns the tasks in the waiting queue with
+// their position in the queue set in their state
+func (sq *SchedulerQueue) waiting() []api.TrainTask {
+	sq.lock.RLock()
+	defer sq.lock.RUnlock()
+
+	tasks := make([]api.TrainTask, 0, len(sq.waitQ))
+	for _, item := range sq.waitQ.sorted() {
+		task := *item.task
+		task.Job.State.Phase = api.PhaseQueued
+		task.Job.State.QueuePosition = len(tasks) + 1
+		tasks = append(tasks, task)
 	}
-	sq.trainQ.PushBack(t)
 
+	return tasks
 }
@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func makeTask(id, priority string) *api.TrainTask {
+	return &api.TrainTask{
+		Parameters: api.TrainRequest{Priority: priority},
+		Job:        api.JobInfo{JobId: id},
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []*api.TrainTask
+		new     []*api.TrainTask
+		want    []string
+	}{
+		{
+			name: "arrival order",
+			new:  []*api.TrainTask{makeTask("a", ""), makeTask("b", ""), makeTask("c", "")},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "priority",
+			new: []*api.TrainTask{
+				makeTask("low", api.PriorityLow),
+				makeTask("normal", api.PriorityNormal),
+				makeTask("high", api.PriorityHigh),
+				makeTask("high2", api.PriorityHigh),
+			},
+			want: []string{"high", "high2", "normal", "low"},
+		},
+		{
+			name:    "updates first",
+			updates: []*api.TrainTask{makeTask("update-low", api.PriorityLow), makeTask("update", "")},
+			new:     []*api.TrainTask{makeTask("new-high", api.PriorityHigh)},
+			want:    []string{"update", "update-low", "new-high"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sq := NewQueue()
+			for _, task := range tt.new {
+				sq.pushAdmitted(task)
+			}
+			for _, task := range tt.updates {
+				sq.pushTask(task)
+			}
+
+			var got []string
+			for range tt.want {
+				task, err := sq.popTask()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, task.Job.JobId)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	sq := NewQueue()
+
+	errs := make(chan error)
+	go func() {
+		_, err := sq.popTask()
+		errs <- err
+	}()
+
+	select {
+	case <-errs:
+		t.Fatal("popTask returned from an empty queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sq.Close()
+	select {
+	case err := <-errs:
+		if err != errQueueClosed {
+			t.Errorf("got error %v, want %v", err, errQueueClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("popTask did not return after the queue was closed")
+	}
+
+	// tasks pushed after closing the queue are not returned
+	sq.pushTask(makeTask("a", ""))
+	if _, err := sq.popTask(); err != errQueueClosed {
+		t.Errorf("got error %v, want %v", err, errQueueClosed)
+	}
+}
+
+func TestAdmitRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  map[string]admitResult
+		admitted []string
+		waiting  []string
+	}{
+		{
+			name:     "all admitted",
+			results:  map[string]admitResult{},
+			admitted: []string{"high", "a", "b", "c"},
+		},
+		{
+			name:     "no overtaking when out of budget",
+			results:  map[string]admitResult{"a": waitBudget},
+			admitted: []string{"high"},
+			waiting:  []string{"a", "b", "c"},
+		},
+		{
+			name:     "skip teams over their share",
+			results:  map[string]admitResult{"a": waitShare},
+			admitted: []string{"high", "b", "c"},
+			waiting:  []string{"a"},
+		},
+		{
+			name:     "nothing admitted",
+			results:  map[string]admitResult{"high": waitBudget},
+			waiting:  []string{"high", "a", "b", "c"},
+			admitted: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sq := NewQueue()
+			for _, task := range []*api.TrainTask{makeTask("a", ""), makeTask("b", ""),
+				makeTask("high", api.PriorityHigh), makeTask("c", "")} {
+				sq.pushRequest(task)
+			}
+
+			tasks := sq.admitRequests(func(task *api.TrainTask) admitResult {
+				return tt.results[task.Job.JobId]
+			})
+
+			var admitted []string
+			for _, task := range tasks {
+				admitted = append(admitted, task.Job.JobId)
+			}
+			if !reflect.DeepEqual(admitted, tt.admitted) {
+				t.Errorf("got admitted %v, want %v", admitted, tt.admitted)
+			}
+
+			var waiting []string
+			for i, task := range sq.waiting() {
+				waiting = append(waiting, task.Job.JobId)
+				if task.Job.State.QueuePosition != i+1 {
+					t.Errorf("task %v got position %v, want %v", task.Job.JobId, task.Job.State.QueuePosition, i+1)
+				}
+			}
+			if !reflect.DeepEqual(waiting, tt.waiting) {
+				t.Errorf("got waiting %v, want %v", waiting, tt.waiting)
+			}
+		})
+	}
+}
+
+func TestRemoveRequest(t *testing.T) {
+	sq := NewQueue()
+	for _, id := range []string{"a", "b", "c"} {
+		sq.pushRequest(makeTask(id, ""))
+	}
+
+	if _, removed := sq.removeRequest("missing"); removed {
+		t.Error("removed a task that is not waiting")
+	}
+	if task, removed := sq.removeRequest("b"); !removed || task.Job.JobId != "b" {
+		t.Errorf("got %v, %v when removing a waiting task", task, removed)
+	}
+
+	var waiting []string
+	for _, task := range sq.waiting() {
+		waiting = append(waiting, task.Job.JobId)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(waiting, want) {
+		t.Errorf("got waiting %v, want %v", waiting, want)
+	}
+	if p := sq.headPriority(); p != priorityOf(makeTask("a", "")) {
+		t.Errorf("got head priority %v", p)
+	}
+}
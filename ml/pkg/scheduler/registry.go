@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// policyRegistry holds the built-in scheduling policies and sends the
+// decisions of each task to the policy it selected in its options, or to
+// the default policy of the scheduler if the task did not choose one
+type policyRegistry struct {
+	logger        *zap.Logger
+	policies      map[string]SchedulerPolicy
+	defaultPolicy string
+}
+
+// makePolicyRegistry creates the built-in policies with the configuration
+// of the scheduler and returns an error if the default policy is unknown
+func makePolicyRegistry(logger *zap.Logger, opts Options) (*policyRegistry, error) {
+	r := &policyRegistry{
+		logger: logger.Named("policies"),
+		policies: map[string]SchedulerPolicy{
+			api.PolicyStatic:      makeStaticPolicy(),
+			api.PolicyThroughput:  makeThroughputPolicy(logger, opts.ScaleUpThreshold, opts.ScaleDownThreshold),
+			api.PolicyConvergence: makeConvergencePolicy(logger),
+			api.PolicyStepSearch:  makeStepSearchPolicy(logger),
+		},
+		defaultPolicy: opts.Policy,
+	}
+
+	// every policy is kept within the parallelism bounds of the tasks
+	for name, policy := range r.policies {
+		r.policies[name] = boundedPolicy{SchedulerPolicy: policy, maxParallelism: opts.MaxParallelism}
+	}
+
+	if r.defaultPolicy == "" {
+		r.defaultPolicy = api.PolicyThroughput
+	}
+	if _, exists := r.policies[r.defaultPolicy]; !exists {
+		return nil, errors.Errorf("unknown scheduling policy \"%v\"", r.defaultPolicy)
+	}
+
+	return r, nil
+}
+
+// exists returns true if the policy is one of the built-in
+// policies, an empty name selects the default policy
+func (r *policyRegistry) exists(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, exists := r.policies[name]
+	return exists
+}
+
+// policyFor returns the policy selected by the task
+func (r *policyRegistry) policyFor(task api.TrainTask) SchedulerPolicy {
+	name := task.Parameters.Options.Policy
+	if name == "" {
+		name = r.defaultPolicy
+	}
+
+	policy, exists := r.policies[name]
+	if !exists {
+		r.logger.Warn("Unknown policy, using the default one",
+			zap.String("task", task.Job.JobId),
+			zap.String("policy", name))
+		return r.policies[r.defaultPolicy]
+	}
+	return policy
+}
+
+func (r *policyRegistry) calculateParallelism(task api.TrainTask) (parallelism int, op TaskOperation) {
+	return r.policyFor(task).calculateParallelism(task)
+}
+
+// taskPaused and taskFinished only receive the id of the task,
+// so they are sent to all the policies, which ignore unknown tasks
+func (r *policyRegistry) taskPaused(taskId string) {
+	for _, policy := range r.policies {
+		policy.taskPaused(taskId)
+	}
+}
+
+func (r *policyRegistry) taskFinished(taskId string) {
+	for _, policy := range r.policies {
+		policy.taskFinished(taskId)
+	}
+}
+
+// state gathers the state of the task in every
+// policy, indexed by the name of the policy
+func (r *policyRegistry) state(taskId string) (json.RawMessage, bool) {
+	states := make(map[string]json.RawMessage)
+	for name, policy := range r.policies {
+		if state, exists := policy.state(taskId); exists {
+			states[name] = state
+		}
+	}
+
+	if len(states) == 0 {
+		return nil, false
+	}
+	return marshalState(states)
+}
+
+func (r *policyRegistry) restore(taskId string, state json.RawMessage) error {
+	var states map[string]json.RawMessage
+	if err := json.Unmarshal(state, &states); err != nil {
+		return errors.Wrap(err, "could not unmarshal policy state")
+	}
+
+	for name, s := range states {
+		policy, exists := r.policies[name]
+		if !exists {
+			continue
+		}
+		if err := policy.restore(taskId, s); err != nil {
+			return errors.Wrapf(err, "could not restore state of policy %v", name)
+		}
+	}
+	return nil
+}
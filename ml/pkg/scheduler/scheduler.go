@@ -1,31 +1,76 @@
 package scheduler
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
 	psClient "github.com/diegostock12/kubeml/ml/pkg/ps/client"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
 	"time"
 )
 
 const (
 	scaleDownLimit = 1.2
 	scaleUpLimit   = 1.05
+
+	// shutdownTimeout is the time given to the API to
+	// finish the requests in flight when shutting down
+	shutdownTimeout = 10 * time.Second
 )
 
 type (
 	TaskOperation int
 
+	// Options configures the resources managed by the scheduler.
+	// FunctionBudget is the maximum number of functions used by all the
+	// tasks at the same time, zero meaning no limit. TeamShares holds the
+	// weights of the teams when splitting the budget among them.
+	// MaxParallelism caps the functions of a single task, zero meaning no limit.
+	// Store keeps the state of the tasks across restarts, by default in memory.
+	//
+	// Policy is the scheduling policy of the tasks that do not choose one,
+	// and the thresholds tune the throughput policy
+	Options struct {
+		FunctionBudget int
+		TeamShares     map[string]float64
+		MaxParallelism int
+		Store          Store
+
+		Policy             string
+		ScaleUpThreshold   float64
+		ScaleDownThreshold float64
+	}
+
 	Scheduler struct {
 		logger *zap.Logger
 
 		// queue that will hold the tasks
-		queue SchedulerQueue
+		queue *SchedulerQueue
 
 		// ps is the client to send requests
 		// and updates to the parameter server
 		ps *psClient.Client
 
 		// SchedulerPolicy to determine the task parallelism
-		policy SchedulerPolicy
+		policy *policyRegistry
+
+		// admission keeps the running tasks under the function budget
+		admission *admission
+
+		// store saves the queued and running tasks
+		store Store
+
+		// server exposes the API, and done is closed
+		// once the scheduling loop has stopped
+		server *http.Server
+		done   chan struct{}
 	}
 )
 
@@ -47,17 +92,16 @@ func (s *Scheduler) consumeMetrics() {
 // to get the number of functions that should be run in the next iteration
 func (s *Scheduler) scheduleTasks() {
 	s.logger.Info("Scheduler started satisfying the requests from the Parameter Servers")
+	defer close(s.done)
 
 	for {
 
-		// Wait until there is an element in the queue
+		// Wait until there is an element in the queue,
+		// the queue is only closed when shutting down
 		task, err := s.queue.popTask()
 		if err != nil {
-			//s.logger.Warn("Schedule queue is empty, sleeping...")
-			// If there is no element sleep
-			// TODO see if the lock is a bottleneck
-			time.Sleep(10 * time.Millisecond)
-			continue
+			s.logger.Info("Scheduler stopped satisfying requests", zap.Error(err))
+			return
 		}
 
 		s.logger.Debug("Serving task", zap.Any("task", task))
@@ -65,6 +109,18 @@ func (s *Scheduler) scheduleTasks() {
 		// calculate the parallelism of the next epoch using the scheduler policy
 		parallelism, operation := s.policy.calculateParallelism(*task)
 
+		// keep the parallelism within the functions allocated to the task
+		switch operation {
+		case CreateTask:
+			parallelism = s.admission.allocation(task.Job.JobId)
+		case UpdateTask:
+			prev := s.admission.allocation(task.Job.JobId)
+			parallelism = s.admission.resize(task, parallelism)
+			if parallelism < prev {
+				s.admitTasks()
+			}
+		}
+
 		// TODO if the scheduling fails, retry as K8s does by putting it in the queue
 		task.Job.State.Parallelism = parallelism
 		switch operation {
@@ -74,6 +130,11 @@ func (s *Scheduler) scheduleTasks() {
 				s.logger.Error("Error sending task creation request to parameter server",
 					zap.Any("task", task),
 					zap.Error(err))
+				s.policy.taskFinished(task.Job.JobId)
+				s.admission.release(task.Job.JobId)
+				s.forget(task.Job.JobId)
+				s.admitTasks()
+				continue
 			}
 
 		case UpdateTask:
@@ -85,7 +146,194 @@ func (s *Scheduler) scheduleTasks() {
 			}
 		}
 
+		s.persist(TaskRecord{Task: *task, Started: true, Functions: parallelism})
+
+	}
+}
+
+// admitTasks resumes the tasks paused by a preemption and admits the
+// waiting tasks that fit in the function budget. The preempted tasks
+// are only resumed before the waiting tasks of lower or equal priority.
+// Admitted tasks are saved before they are moved to the training queue,
+// so they are not seen as started if the scheduler restarts before
+// starting them, and the store is not called with the queue locked
+func (s *Scheduler) admitTasks() {
+	for _, id := range s.admission.resumable(s.queue.headPriority()) {
+		go s.resumeTask(id)
+	}
+
+	admitted := s.queue.admitRequests(s.tryAdmit)
+	for _, task := range admitted {
+		functions := s.admission.allocation(task.Job.JobId)
+		s.persist(TaskRecord{Task: *task, Functions: functions})
+		s.queue.pushAdmitted(task)
+
+		s.logger.Info("Admitted task",
+			zap.String("task", task.Job.JobId),
+			zap.Int("parallelism", functions))
+	}
+}
+
+// persist saves the record of a task along with the state
+// the policies keep about it. Errors are only logged, since
+// the scheduler can keep working without the store
+func (s *Scheduler) persist(rec TaskRecord) {
+	if state, exists := s.policy.state(rec.Task.Job.JobId); exists {
+		rec.PolicyState = state
+	}
+
+	if err := s.store.Save(rec); err != nil {
+		s.logger.Error("Could not save task",
+			zap.String("task", rec.Task.Job.JobId),
+			zap.Error(err))
+	}
+}
+
+// forget deletes the record of a task that is no longer scheduled
+func (s *Scheduler) forget(taskId string) {
+	if err := s.store.Delete(taskId); err != nil {
+		s.logger.Error("Could not delete task",
+			zap.String("task", taskId),
+			zap.Error(err))
+	}
+}
+
+// restore loads the tasks saved before the scheduler restarted. Queued
+// tasks go back to the waiting queue in order of submission and admitted
+// tasks that were not started go back to the training queue. Started tasks
+// get back their functions and policy state so their next request is served
+// as an update, and their pending update requests are queued again. The
+// allocations of the started tasks are corrected at their next update if
+// they changed after being saved.
+//
+// Started tasks missing from running finished while the scheduler was down,
+// so their records are deleted instead. A nil running keeps all of them
+func (s *Scheduler) restore(running map[string]bool) error {
+	records, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Submitted.Before(records[j].Submitted)
+	})
+
+	for i := range records {
+		rec := &records[i]
+		task := &rec.Task
+		if rec.Queued {
+			s.admission.enqueue(task)
+			s.queue.pushRequest(task)
+			continue
+		}
+
+		if rec.Started && running != nil && !running[task.Job.JobId] {
+			s.logger.Info("Task finished while the scheduler was down",
+				zap.String("task", task.Job.JobId))
+			s.forget(task.Job.JobId)
+			continue
+		}
+
+		s.admission.restore(task, rec.Functions)
+		if !rec.Started {
+			s.queue.pushAdmitted(task)
+			continue
+		}
+
+		if len(rec.PolicyState) != 0 {
+			if err := s.policy.restore(task.Job.JobId, rec.PolicyState); err != nil {
+				s.logger.Error("Could not restore policy state",
+					zap.String("task", task.Job.JobId),
+					zap.Error(err))
+			}
+		}
+		if rec.Pending {
+			s.queue.pushTask(task)
+		}
+	}
+
+	s.logger.Info("Restored tasks", zap.Int("tasks", len(records)))
+	s.admitTasks()
+	return nil
+}
+
+// runningTasks returns the ids of the tasks in the parameter server
+func (s *Scheduler) runningTasks() (map[string]bool, error) {
+	body, err := s.ps.ListTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []api.TrainTask
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal tasks")
+	}
+
+	ids := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		ids[task.Job.JobId] = true
 	}
+	return ids, nil
+}
+
+// tryAdmit admits a task if it fits in the budget, preempting
+// the running tasks of lower priority if needed
+func (s *Scheduler) tryAdmit(task *api.TrainTask) admitResult {
+	result, actions := s.admission.admitPreempting(task)
+	for _, action := range actions {
+		s.logger.Info("Preempting task",
+			zap.String("task", action.taskId),
+			zap.String("action", action.action),
+			zap.String("by", task.Job.JobId))
+
+		go s.notifyPreemption(task, action)
+	}
+
+	return result
+}
+
+// notifyPreemption tells a task that it was preempted, so it records
+// the preemption and pauses at the end of its epoch if needed
+func (s *Scheduler) notifyPreemption(task *api.TrainTask, action preemption) {
+	err := s.ps.PreemptTask(action.taskId, api.Preemption{
+		Action:      action.action,
+		Parallelism: action.parallelism,
+		JobId:       task.Job.JobId,
+		Priority:    task.Parameters.Priority,
+	})
+	if err != nil {
+		s.logger.Error("Could not notify the preemption",
+			zap.String("task", action.taskId),
+			zap.Error(err))
+	}
+}
+
+// resumeTask resumes a task paused by a preemption, marking it as
+// preempted again if it cannot be resumed so it is retried later
+func (s *Scheduler) resumeTask(taskId string) {
+	s.logger.Info("Resuming preempted task", zap.String("task", taskId))
+
+	if err := s.ps.ResumeTask(taskId); err != nil {
+		s.logger.Error("Could not resume preempted task",
+			zap.String("task", taskId),
+			zap.Error(err))
+		s.admission.repreempt(taskId)
+	}
+}
+
+// Close stops the scheduler, first the API so no more requests
+// are received and then the scheduling loop, which finishes the
+// task it is serving before stopping
+func (s *Scheduler) Close() {
+	s.logger.Info("Shutting down the scheduler")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Error("Could not shut down the scheduler api", zap.Error(err))
+	}
+
+	s.queue.Close()
+	<-s.done
 }
 
 // Start starts all of the goroutines that will take care of the proper
@@ -95,23 +343,55 @@ func (s *Scheduler) scheduleTasks() {
 // 3) **maybe look for the failed tasks queue? If the router fails
 // keep the task there and retry
 // 4) API so the scheduler is reachable from the other components
-func Start(logger *zap.Logger, port int, psUrl string) {
+func Start(logger *zap.Logger, port int, psUrl string, opts Options) {
 
 	// Create the scheduler
 	s := &Scheduler{
-		logger: logger.Named("scheduler"),
-		queue:  NewQueue(),
+		logger:    logger.Named("scheduler"),
+		queue:     NewQueue(),
+		admission: makeAdmission(opts.FunctionBudget, opts.TeamShares, opts.MaxParallelism),
+		done:      make(chan struct{}),
 	}
+	s.server = &http.Server{Addr: fmt.Sprintf(":%v", port), Handler: s.GetHandler()}
 
-	// set the ps client
+	// set the ps client and the scheduling policies
 	s.ps = psClient.MakeClient(s.logger, psUrl)
-	s.policy = makeThroughputPolicy(s.logger)
+	policy, err := makePolicyRegistry(s.logger, opts)
+	if err != nil {
+		s.logger.Fatal("Could not create the scheduling policies", zap.Error(err))
+	}
+	s.policy = policy
+
+	// restore the tasks saved before a restart, dropping the ones that are
+	// no longer in the parameter server. If the store cannot be read
+	// the scheduler starts empty and keeps the tasks in memory
+	s.store = opts.Store
+	if s.store == nil {
+		s.store = MakeMemoryStore()
+	}
+	running, err := s.runningTasks()
+	if err != nil {
+		s.logger.Warn("Could not list the tasks in the parameter server, keeping all the saved tasks", zap.Error(err))
+	}
+	if err := s.restore(running); err != nil {
+		s.logger.Warn("Could not restore the saved tasks, keeping the tasks in memory", zap.Error(err))
+		s.store = MakeMemoryStore()
+	}
 
 	// Train consuming metrics and also listening for requests
 	go s.consumeMetrics()
 	go s.scheduleTasks()
 
+	// shut down gracefully when kubernetes stops the pod
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM)
+	go func() {
+		<-stop
+		s.Close()
+	}()
+
 	// Finally start the API
-	s.Serve(port)
+	s.Serve()
+	<-s.done
 
 }
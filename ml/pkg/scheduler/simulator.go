@@ -0,0 +1,323 @@
+package scheduler
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"math"
+)
+
+// minEpochDuration keeps the predicted duration of an
+// epoch positive when the fitted model goes below zero
+const minEpochDuration = 1e-3
+
+type (
+	// SimulationJob is a job of the workload replayed by the simulator,
+	// submitted Arrival seconds after the start of the simulation
+	SimulationJob struct {
+		Arrival float64          `json:"arrival"`
+		Request api.TrainRequest `json:"request"`
+	}
+
+	// EpochModel predicts the duration of an epoch of a function with a given
+	// parallelism as A + B/p, where A is the cost that does not shrink with more
+	// functions, such as loading and merging the models, and B is the work split
+	// among the functions. Loss holds the mean train loss of each epoch, used
+	// by the policies that follow the convergence of the jobs
+	EpochModel struct {
+		A    float64   `json:"a"`
+		B    float64   `json:"b"`
+		Loss []float64 `json:"loss,omitempty"`
+	}
+
+	// SimulationResult holds the metrics of a workload run with a policy.
+	// Makespan is the time until the last job finishes, AverageCompletion is
+	// the mean time between the arrival and the end of the jobs, and
+	// FunctionSeconds is the time used by all the functions together
+	SimulationResult struct {
+		Policy            string  `json:"policy"`
+		Jobs              int     `json:"jobs"`
+		Makespan          float64 `json:"makespan"`
+		AverageCompletion float64 `json:"average_completion"`
+		FunctionSeconds   float64 `json:"function_seconds"`
+	}
+
+	// simulatedJob is the state of a job during the simulation,
+	// paused is set while the job is paused by a preemption
+	simulatedJob struct {
+		task    *api.TrainTask
+		model   EpochModel
+		arrival float64
+		epoch   int
+		started float64
+		paused  bool
+	}
+
+	// simEvent is either the arrival of a job or the end of one of its epochs
+	simEvent struct {
+		time    float64
+		arrival bool
+		job     *simulatedJob
+		seq     int
+	}
+
+	simEvents []*simEvent
+)
+
+func (e simEvents) Len() int { return len(e) }
+
+func (e simEvents) Less(i, j int) bool {
+	if e[i].time != e[j].time {
+		return e[i].time < e[j].time
+	}
+	return e[i].seq < e[j].seq
+}
+
+func (e simEvents) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+
+func (e *simEvents) Push(x interface{}) { *e = append(*e, x.(*simEvent)) }
+
+func (e *simEvents) Pop() interface{} {
+	old := *e
+	n := len(old)
+	event := old[n-1]
+	old[n-1] = nil
+	*e = old[:n-1]
+	return event
+}
+
+// duration returns the predicted duration of an epoch with the given parallelism
+func (m EpochModel) duration(parallelism int) float64 {
+	d := m.A + m.B/float64(parallelism)
+	if d < minEpochDuration {
+		return minEpochDuration
+	}
+	return d
+}
+
+// loss returns the train loss of the given epoch, starting at 1
+func (m EpochModel) loss(epoch int) float64 {
+	switch {
+	case len(m.Loss) == 0:
+		return 0
+	case epoch > len(m.Loss):
+		return m.Loss[len(m.Loss)-1]
+	default:
+		return m.Loss[epoch-1]
+	}
+}
+
+// FitEpochModel fits the epoch model with least squares to the duration
+// and parallelism of the epochs in the histories. If all the epochs ran with
+// the same parallelism the fixed cost cannot be told apart, so the epochs
+// are assumed to scale perfectly with the number of functions
+func FitEpochModel(histories []api.History) (EpochModel, error) {
+	var xs, ys []float64
+	var lossSum []float64
+	var lossCount []int
+	for _, h := range histories {
+		for i, d := range h.Data.EpochDuration {
+			if i >= len(h.Data.Parallelism) || h.Data.Parallelism[i] <= 0 || d <= 0 {
+				continue
+			}
+			xs = append(xs, 1/h.Data.Parallelism[i])
+			ys = append(ys, d)
+		}
+
+		for i, l := range h.Data.TrainLoss {
+			if i == len(lossSum) {
+				lossSum = append(lossSum, 0)
+				lossCount = append(lossCount, 0)
+			}
+			lossSum[i] += l
+			lossCount[i]++
+		}
+	}
+
+	if len(xs) == 0 {
+		return EpochModel{}, errors.New("no epochs to fit the model")
+	}
+
+	var model EpochModel
+	for i := range lossSum {
+		model.Loss = append(model.Loss, lossSum[i]/float64(lossCount[i]))
+	}
+
+	n := float64(len(xs))
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+
+	if den := n*sxx - sx*sx; math.Abs(den) > 1e-12 {
+		model.B = (n*sxy - sx*sy) / den
+		model.A = (sy - model.B*sx) / n
+	} else {
+		model.B = sy / sx
+	}
+
+	return model, nil
+}
+
+// FitEpochModels fits a model for each of the functions in the histories
+func FitEpochModels(histories []api.History) map[string]EpochModel {
+	byFunction := make(map[string][]api.History)
+	for _, h := range histories {
+		byFunction[h.Task.FunctionName] = append(byFunction[h.Task.FunctionName], h)
+	}
+
+	models := make(map[string]EpochModel, len(byFunction))
+	for name, hs := range byFunction {
+		if model, err := FitEpochModel(hs); err == nil {
+			models[name] = model
+		}
+	}
+	return models
+}
+
+// Simulate replays the workload with the given policy as the policy of all
+// the jobs, using the admission of the scheduler with the budget, shares and
+// caps in the options. Each job uses the model of its function, or the
+// fallback model if there is none. Preemptions are simulated as in the
+// scheduler, the preempted jobs are scaled down or paused at the end of
+// their current epoch and resumed once their functions are free
+func Simulate(logger *zap.Logger, workload []SimulationJob, models map[string]EpochModel,
+	fallback *EpochModel, policyName string, opts Options) (*SimulationResult, error) {
+
+	opts.Policy = policyName
+	policy, err := makePolicyRegistry(logger, opts)
+	if err != nil {
+		return nil, err
+	}
+	admission := makeAdmission(opts.FunctionBudget, opts.TeamShares, opts.MaxParallelism)
+	queue := NewQueue()
+
+	var events simEvents
+	seq := 0
+	schedule := func(t float64, arrival bool, job *simulatedJob) {
+		seq++
+		heap.Push(&events, &simEvent{time: t, arrival: arrival, job: job, seq: seq})
+	}
+
+	jobs := make(map[string]*simulatedJob, len(workload))
+	for i, sj := range workload {
+		model, exists := models[sj.Request.FunctionName]
+		if !exists {
+			if fallback == nil {
+				return nil, errors.Errorf("no epoch model for function \"%v\"", sj.Request.FunctionName)
+			}
+			model = *fallback
+		}
+		if sj.Request.Epochs <= 0 {
+			return nil, errors.Errorf("job %v should train at least one epoch", i)
+		}
+
+		req := sj.Request
+		req.Options.Policy = ""
+		if req.Options.DefaultParallelism <= 0 {
+			req.Options.DefaultParallelism = api.DefaultParallelism
+		}
+
+		job := &simulatedJob{
+			task: &api.TrainTask{
+				Parameters: req,
+				Job:        api.JobInfo{JobId: fmt.Sprintf("sim-%d", i)},
+			},
+			model:   model,
+			arrival: sj.Arrival,
+		}
+		jobs[job.task.Job.JobId] = job
+		schedule(sj.Arrival, true, job)
+	}
+
+	result := &SimulationResult{Policy: policyName, Jobs: len(workload)}
+
+	// runEpoch starts the next epoch of a job with the given parallelism
+	runEpoch := func(now float64, job *simulatedJob, parallelism int) {
+		job.task.Job.State.Parallelism = parallelism
+		job.started = now
+		schedule(now+job.model.duration(parallelism), false, job)
+	}
+
+	// admit resumes the preempted jobs that fit and starts the waiting
+	// jobs that fit in the budget, preempting the jobs of lower priority
+	admitPreempting := func(task *api.TrainTask) admitResult {
+		result, _ := admission.admitPreempting(task)
+		return result
+	}
+	admit := func(now float64) {
+		for _, id := range admission.resumable(queue.headPriority()) {
+			if job := jobs[id]; job.paused {
+				job.paused = false
+				runEpoch(now, job, admission.allocation(id))
+			}
+		}
+
+		for _, task := range queue.admitRequests(admitPreempting) {
+			policy.calculateParallelism(*task)
+			runEpoch(now, jobs[task.Job.JobId], admission.allocation(task.Job.JobId))
+		}
+	}
+
+	finished := 0
+	var completion float64
+	for events.Len() > 0 {
+		event := heap.Pop(&events).(*simEvent)
+		now, job := event.time, event.job
+		id := job.task.Job.JobId
+
+		if event.arrival {
+			admission.enqueue(job.task)
+			queue.pushRequest(job.task)
+			admit(now)
+			continue
+		}
+
+		elapsed := now - job.started
+		result.FunctionSeconds += elapsed * float64(job.task.Job.State.Parallelism)
+		job.epoch++
+
+		if job.epoch >= job.task.Parameters.Epochs {
+			policy.taskFinished(id)
+			admission.release(id)
+			finished++
+			completion += now - job.arrival
+			result.Makespan = now
+			admit(now)
+			continue
+		}
+
+		job.task.Job.State.ElapsedTime = elapsed
+		job.task.Job.State.Epoch = job.epoch
+		job.task.Job.State.Loss = job.model.loss(job.epoch)
+
+		// a job paused by a preemption waits until it is resumed
+		if admission.isPreempted(id) {
+			job.paused = true
+			policy.taskPaused(id)
+			continue
+		}
+
+		prev := admission.allocation(id)
+		parallelism, _ := policy.calculateParallelism(*job.task)
+		parallelism = admission.resize(job.task, parallelism)
+		runEpoch(now, job, parallelism)
+		if parallelism < prev {
+			admit(now)
+		}
+	}
+
+	if finished < len(workload) {
+		return nil, errors.Errorf("%v jobs never fit in the function budget", len(workload)-finished)
+	}
+	if finished > 0 {
+		result.AverageCompletion = completion / float64(finished)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+	"math"
+	"testing"
+)
+
+func makeHistory(function string, parallelism []float64, durations []float64, loss []float64) api.History {
+	return api.History{
+		Task: api.TrainRequest{FunctionName: function},
+		Data: api.JobHistory{
+			Parallelism:   parallelism,
+			EpochDuration: durations,
+			TrainLoss:     loss,
+		},
+	}
+}
+
+func TestFitEpochModel(t *testing.T) {
+	var parallelism, durations []float64
+	for p := 1.0; p <= 8; p++ {
+		parallelism = append(parallelism, p)
+		durations = append(durations, 5+40/p)
+	}
+
+	tests := []struct {
+		name      string
+		histories []api.History
+		want      EpochModel
+		wantErr   bool
+	}{
+		{
+			name:      "fixed and parallel cost",
+			histories: []api.History{makeHistory("net", parallelism, durations, nil)},
+			want:      EpochModel{A: 5, B: 40},
+		},
+		{
+			name: "several histories",
+			histories: []api.History{
+				makeHistory("net", []float64{1, 2}, []float64{45, 25}, []float64{2, 1}),
+				makeHistory("net", []float64{4}, []float64{15}, []float64{4}),
+			},
+			want: EpochModel{A: 5, B: 40, Loss: []float64{3, 1}},
+		},
+		{
+			name:      "single parallelism",
+			histories: []api.History{makeHistory("net", []float64{4, 4}, []float64{10, 10}, nil)},
+			want:      EpochModel{A: 0, B: 40},
+		},
+		{
+			name:      "invalid epochs are skipped",
+			histories: []api.History{makeHistory("net", []float64{2, 0, 4}, []float64{20, 30, 10, 5}, nil)},
+			want:      EpochModel{A: 0, B: 40},
+		},
+		{
+			name:    "no epochs",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FitEpochModel(tt.histories)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if math.Abs(got.A-tt.want.A) > 1e-9 || math.Abs(got.B-tt.want.B) > 1e-9 {
+				t.Errorf("got model %v + %v/p, want %v + %v/p", got.A, got.B, tt.want.A, tt.want.B)
+			}
+			if len(got.Loss) != len(tt.want.Loss) {
+				t.Fatalf("got loss %v, want %v", got.Loss, tt.want.Loss)
+			}
+			for i := range got.Loss {
+				if math.Abs(got.Loss[i]-tt.want.Loss[i]) > 1e-9 {
+					t.Errorf("got loss %v, want %v", got.Loss, tt.want.Loss)
+				}
+			}
+		})
+	}
+}
+
+func makeSimulationJob(arrival float64, priority string, epochs, parallelism, min int) SimulationJob {
+	return SimulationJob{
+		Arrival: arrival,
+		Request: api.TrainRequest{
+			FunctionName: "net",
+			Epochs:       epochs,
+			Priority:     priority,
+			Options: api.TrainOptions{
+				DefaultParallelism: parallelism,
+				MinParallelism:     min,
+			},
+		},
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	// every epoch takes 40 seconds of a single function
+	models := map[string]EpochModel{"net": {B: 40}}
+
+	tests := []struct {
+		name     string
+		budget   int
+		workload []SimulationJob
+		want     SimulationResult
+		wantErr  bool
+	}{
+		{
+			name:     "single job",
+			budget:   4,
+			workload: []SimulationJob{makeSimulationJob(0, "", 3, 4, 1)},
+			want:     SimulationResult{Jobs: 1, Makespan: 30, AverageCompletion: 30, FunctionSeconds: 120},
+		},
+		{
+			name:   "jobs wait for the budget",
+			budget: 4,
+			workload: []SimulationJob{
+				makeSimulationJob(0, "", 2, 4, 4),
+				makeSimulationJob(0, "", 1, 4, 4),
+			},
+			want: SimulationResult{Jobs: 2, Makespan: 30, AverageCompletion: 25, FunctionSeconds: 120},
+		},
+		{
+			// the low priority job is scaled down to its minimum at the end of its
+			// first epoch, and the static policy keeps it there for the next ones
+			name:   "scale down preemption",
+			budget: 4,
+			workload: []SimulationJob{
+				makeSimulationJob(0, api.PriorityLow, 4, 4, 2),
+				makeSimulationJob(5, api.PriorityHigh, 1, 2, 2),
+			},
+			want: SimulationResult{Jobs: 2, Makespan: 70, AverageCompletion: 45, FunctionSeconds: 200},
+		},
+		{
+			// the low priority job is paused at the end of its first
+			// epoch and resumed once the high priority one finishes
+			name:   "pause preemption",
+			budget: 4,
+			workload: []SimulationJob{
+				makeSimulationJob(0, api.PriorityLow, 4, 4, 4),
+				makeSimulationJob(5, api.PriorityHigh, 1, 2, 2),
+			},
+			want: SimulationResult{Jobs: 2, Makespan: 55, AverageCompletion: 37.5, FunctionSeconds: 200},
+		},
+		{
+			name:     "job that never fits",
+			budget:   4,
+			workload: []SimulationJob{makeSimulationJob(0, "", 1, 6, 6)},
+			wantErr:  true,
+		},
+		{
+			name:     "job without epochs",
+			workload: []SimulationJob{makeSimulationJob(0, "", 0, 2, 1)},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{FunctionBudget: tt.budget}
+			got, err := Simulate(zap.NewNop(), tt.workload, models, nil, api.PolicyStatic, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			tt.want.Policy = api.PolicyStatic
+			if *got != tt.want {
+				t.Errorf("got result %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimulateMissingModel(t *testing.T) {
+	workload := []SimulationJob{makeSimulationJob(0, "", 1, 2, 1)}
+	workload[0].Request.FunctionName = "other"
+
+	if _, err := Simulate(zap.NewNop(), workload, nil, nil, api.PolicyStatic, Options{}); err == nil {
+		t.Error("expected an error for a function without a model")
+	}
+
+	fallback := EpochModel{B: 10}
+	got, err := Simulate(zap.NewNop(), workload, nil, &fallback, api.PolicyStatic, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Makespan != 5 {
+		t.Errorf("got makespan %v with the fallback model, want 5", got.Makespan)
+	}
+}
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/diegostock12/kubeml/ml/pkg/util"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+)
+
+const (
+	storeDatabase   = "kubeml"
+	storeCollection = "scheduler"
+)
+
+type (
+	// Store keeps the state of the tasks of the scheduler
+	// so it can be restored after the scheduler restarts
+	Store interface {
+		Save(rec TaskRecord) error
+		Delete(taskId string) error
+		Load() ([]TaskRecord, error)
+	}
+
+	// TaskRecord is the state saved for a task. Queued tasks are waiting to
+	// be admitted and are restored in order of submission. Admitted tasks that
+	// were not started yet go back to the training queue to be started, and
+	// started tasks are restored with the functions allocated to them and the
+	// state the policies keep about them, so they are not scheduled again as
+	// new tasks. Pending is set while a started task has an update request
+	// waiting in the training queue, which is queued again on restore
+	TaskRecord struct {
+		Task        api.TrainTask   `json:"task"`
+		Queued      bool            `json:"queued"`
+		Started     bool            `json:"started"`
+		Pending     bool            `json:"pending"`
+		Submitted   time.Time       `json:"submitted"`
+		Functions   int             `json:"functions"`
+		PolicyState json.RawMessage `json:"policy_state,omitempty"`
+	}
+
+	// MemoryStore keeps the records in memory, so
+	// they do not survive a restart of the scheduler
+	MemoryStore struct {
+		records map[string]TaskRecord
+		mu      sync.Mutex
+	}
+
+	// MongoStore keeps the records in the database. The record is saved
+	// as a json document since the tasks only define json field names
+	MongoStore struct {
+		client *mongo.Client
+	}
+
+	mongoRecord struct {
+		Id   string `bson:"_id"`
+		Data string `bson:"data"`
+	}
+)
+
+func MakeMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]TaskRecord)}
+}
+
+func (ms *MemoryStore) Save(rec TaskRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.records[rec.Task.Job.JobId] = rec
+	return nil
+}
+
+func (ms *MemoryStore) Delete(taskId string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.records, taskId)
+	return nil
+}
+
+func (ms *MemoryStore) Load() ([]TaskRecord, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	records := make([]TaskRecord, 0, len(ms.records))
+	for _, rec := range ms.records {
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// MakeMongoStore connects to the database of KubeML
+func MakeMongoStore() (*MongoStore, error) {
+	var uri string
+	if util.IsDebugEnv() {
+		uri = api.MongoUrlDebug
+	} else {
+		uri = fmt.Sprintf("mongodb://%s:%d", api.MongoUrl, api.MongoPort)
+	}
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create the database client")
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to the database")
+	}
+
+	return &MongoStore{client: client}, nil
+}
+
+func (ms *MongoStore) collection() *mongo.Collection {
+	return ms.client.Database(storeDatabase).Collection(storeCollection)
+}
+
+func (ms *MongoStore) Save(rec TaskRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal task record")
+	}
+
+	id := rec.Task.Job.JobId
+	_, err = ms.collection().ReplaceOne(context.TODO(),
+		bson.M{"_id": id},
+		mongoRecord{Id: id, Data: string(data)},
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.Wrap(err, "could not save task record")
+	}
+
+	return nil
+}
+
+func (ms *MongoStore) Delete(taskId string) error {
+	_, err := ms.collection().DeleteOne(context.TODO(), bson.M{"_id": taskId})
+	if err != nil {
+		return errors.Wrap(err, "could not delete task record")
+	}
+	return nil
+}
+
+func (ms *MongoStore) Load() ([]TaskRecord, error) {
+	cursor, err := ms.collection().Find(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list task records")
+	}
+
+	var docs []mongoRecord
+	err = cursor.All(context.TODO(), &docs)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not extract task records from cursor")
+	}
+
+	records := make([]TaskRecord, 0, len(docs))
+	for _, doc := range docs {
+		var rec TaskRecord
+		if err := json.Unmarshal([]byte(doc.Data), &rec); err != nil {
+			return nil, errors.Wrapf(err, "could not unmarshal record of task %v", doc.Id)
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,186 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func makeTestScheduler(t *testing.T, store Store, budget int) *Scheduler {
+	policy, err := makePolicyRegistry(zap.NewNop(), Options{Policy: api.PolicyStatic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Scheduler{
+		logger:    zap.NewNop(),
+		queue:     NewQueue(),
+		policy:    policy,
+		admission: makeAdmission(budget, nil, 0),
+		store:     store,
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := MakeMemoryStore()
+	first := TaskRecord{Task: *makeTask("a", ""), Queued: true, Submitted: time.Unix(10, 0)}
+	second := TaskRecord{Task: *makeTask("b", ""), Started: true, Functions: 4}
+
+	for _, rec := range []TaskRecord{first, second} {
+		if err := store.Save(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// saving a task again replaces its record
+	second.Pending = true
+	if err := store.Save(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []TaskRecord{second}; !reflect.DeepEqual(records, want) {
+		t.Errorf("got records %v, want %v", records, want)
+	}
+}
+
+func TestTaskRecordJSON(t *testing.T) {
+	// the mongo store saves the records as json documents
+	rec := TaskRecord{
+		Task:        *makeTask("a", api.PriorityHigh),
+		Started:     true,
+		Pending:     true,
+		Submitted:   time.Unix(10, 0).UTC(),
+		Functions:   4,
+		PolicyState: json.RawMessage(`{"static":true}`),
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got TaskRecord
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rec) {
+		t.Errorf("got record %+v, want %+v", got, rec)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	store := MakeMemoryStore()
+	before := makeTestScheduler(t, store, 6)
+
+	// a running task with its policy state and a pending update
+	running := makeTeamTask("running", "a", "", 4, 1)
+	before.policy.calculateParallelism(*running)
+	state, exists := before.policy.state("running")
+	if !exists {
+		t.Fatal("the policy has no state of the running task")
+	}
+	before.persist(TaskRecord{Task: *running, Started: true, Pending: true, Functions: 4})
+
+	// a task admitted but not started, and a task waiting in the queue
+	// that does not fit in the budget after the restart
+	admittedTask := makeTeamTask("admitted", "a", "", 2, 1)
+	before.persist(TaskRecord{Task: *admittedTask, Functions: 2})
+	queued := makeTeamTask("queued", "a", "", 4, 2)
+	before.persist(TaskRecord{Task: *queued, Queued: true, Submitted: time.Now()})
+
+	after := makeTestScheduler(t, store, 6)
+	if err := after.restore(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, functions := range map[string]int{"running": 4, "admitted": 2, "queued": 0} {
+		if got := after.admission.allocation(id); got != functions {
+			t.Errorf("task %v got %v functions, want %v", id, got, functions)
+		}
+	}
+	if got, _ := after.policy.state("running"); !reflect.DeepEqual(got, state) {
+		t.Errorf("got policy state %s, want %s", got, state)
+	}
+
+	// the pending update of the running task is served
+	// before the admitted task is started
+	for _, want := range []string{"running", "admitted"} {
+		task, err := after.queue.popTask()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Job.JobId != want {
+			t.Errorf("got task %v, want %v", task.Job.JobId, want)
+		}
+	}
+
+	waiting := after.queue.waiting()
+	if len(waiting) != 1 || waiting[0].Job.JobId != "queued" {
+		t.Errorf("got waiting tasks %v, want the queued task", waiting)
+	}
+}
+
+func TestRestoreFinished(t *testing.T) {
+	store := MakeMemoryStore()
+	before := makeTestScheduler(t, store, 4)
+
+	// the finished task is no longer in the parameter server, and its
+	// functions let the queued task be admitted after the restart
+	before.persist(TaskRecord{Task: *makeTeamTask("running", "a", "", 2, 1), Started: true, Functions: 2})
+	before.persist(TaskRecord{Task: *makeTeamTask("finished", "a", "", 2, 1), Started: true, Functions: 2})
+	before.persist(TaskRecord{Task: *makeTeamTask("queued", "a", "", 2, 2), Queued: true, Submitted: time.Now()})
+
+	after := makeTestScheduler(t, store, 4)
+	if err := after.restore(map[string]bool{"running": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, functions := range map[string]int{"running": 2, "finished": 0, "queued": 2} {
+		if got := after.admission.allocation(id); got != functions {
+			t.Errorf("task %v got %v functions, want %v", id, got, functions)
+		}
+	}
+
+	records, _ := store.Load()
+	for _, rec := range records {
+		if rec.Task.Job.JobId == "finished" {
+			t.Error("the record of the finished task was not deleted")
+		}
+	}
+}
+
+func TestAdmitTasksSaves(t *testing.T) {
+	store := MakeMemoryStore()
+	s := makeTestScheduler(t, store, 4)
+
+	for _, task := range []*api.TrainTask{makeTeamTask("a", "a", "", 4, 2), makeTeamTask("b", "a", "", 4, 2)} {
+		s.admission.enqueue(task)
+		s.queue.pushRequest(task)
+	}
+	s.admitTasks()
+
+	// only the task that fits is saved as admitted and can be started
+	task, err := s.queue.popTask()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Job.JobId != "a" {
+		t.Errorf("got task %v, want a", task.Job.JobId)
+	}
+
+	records, _ := store.Load()
+	if len(records) != 1 || records[0].Task.Job.JobId != "a" ||
+		records[0].Queued || records[0].Started || records[0].Functions != 4 {
+		t.Errorf("got records %+v, want the admitted task with 4 functions", records)
+	}
+	if waiting := s.queue.waiting(); len(waiting) != 1 || waiting[0].Job.JobId != "b" {
+		t.Errorf("got waiting tasks %v, want b", waiting)
+	}
+}
@@ -0,0 +1,104 @@
+package sweep
+
+import (
+	"context"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+)
+
+// CrossValidate launches the jobs of a k-fold cross validation run, one per fold
+// and all of them at the same time. Each job holds out its fold of the train set
+// for validation. Once they finish, a summary is saved in the history with the id of the run
+func (r *Runner) CrossValidate(req api.TrainRequest) (*api.Sweep, error) {
+	if req.Options.Folds < 2 {
+		return nil, errors.New("cross validation needs at least 2 folds")
+	}
+
+	folds := make([]float64, req.Options.Folds)
+	for i := range folds {
+		folds[i] = float64(i)
+	}
+
+	return r.Create(api.SweepRequest{
+		Base:        req,
+		Strategy:    api.SweepFolds,
+		Concurrency: req.Options.Folds,
+		Metric:      "accuracy",
+		Parameters: map[string]api.SweepParameter{
+			ParamFold: {Values: folds},
+		},
+	})
+}
+
+// saveSummary aggregates the final validation results of the folds of a
+// cross validation run and saves them in the history collection
+func (r *Runner) saveSummary(sweep *api.Sweep) error {
+	summary := &api.CrossValidationSummary{}
+
+	var accuracies, losses []float64
+	for _, trial := range sweep.Trials {
+		result := api.FoldResult{
+			Fold:   int(trial.Parameters[ParamFold]),
+			JobId:  trial.JobId,
+			Status: trial.Status,
+		}
+
+		if trial.Status == api.StatusSucceeded {
+			history, err := r.fetchHistory(trial.JobId)
+			if err != nil {
+				return errors.Wrapf(err, "could not get history of fold %v", result.Fold)
+			}
+
+			result.Accuracy, _ = metricValue(history.Data, "accuracy")
+			result.Loss, _ = metricValue(history.Data, "validation_loss")
+			accuracies = append(accuracies, result.Accuracy)
+			losses = append(losses, result.Loss)
+		}
+
+		summary.Folds = append(summary.Folds, result)
+	}
+
+	summary.MeanAccuracy, summary.StdAccuracy = meanStd(accuracies)
+	summary.MeanLoss, summary.StdLoss = meanStd(losses)
+
+	h := api.History{
+		Id:              sweep.Id,
+		Task:            sweep.Request.Base,
+		Status:          sweep.Status,
+		CrossValidation: summary,
+	}
+
+	collection := r.mongoClient.Database(database).Collection(historyCollection)
+	_, err := collection.ReplaceOne(context.TODO(),
+		bson.M{"_id": sweep.Id},
+		h,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.Wrap(err, "could not save summary")
+	}
+
+	return nil
+}
+
+// meanStd returns the mean and the standard deviation of the values
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
@@ -0,0 +1,126 @@
+package sweep
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultEta       = 3
+	defaultMinEpochs = 1
+)
+
+// rungs returns the epochs at which the trials of a bracket are compared. The
+// first rung of bracket s is at MinEpochs*Eta^s and each of the next ones is
+// Eta times further, as long as they are before the last epoch of the trial
+func rungs(opts *api.PruningOptions, bracket, epochs int) []int {
+	r := opts.MinEpochs
+	for i := 0; i < bracket; i++ {
+		r *= opts.Eta
+	}
+
+	var points []int
+	for ; r < epochs; r *= opts.Eta {
+		points = append(points, r)
+	}
+	return points
+}
+
+// numBrackets returns the number of brackets the trials are spread in.
+// Successive halving uses a single one, while hyperband has one starting at
+// each rung plus a last bracket in which the trials are never pruned
+func numBrackets(opts *api.PruningOptions, epochs int) int {
+	if opts.Policy != api.PruningHyperband {
+		return 1
+	}
+	return len(rungs(opts, 0, epochs)) + 1
+}
+
+// assignBrackets spreads the trials of the sweep evenly among the brackets
+func assignBrackets(sweep *api.Sweep) {
+	opts := sweep.Request.Pruning
+	if opts == nil {
+		return
+	}
+
+	for i := range sweep.Trials {
+		trial := &sweep.Trials[i]
+		epochs := applyParameters(sweep.Request.Base, trial.Parameters).Epochs
+		trial.Bracket = i % numBrackets(opts, epochs)
+	}
+}
+
+// promote returns true if the trial is among the best 1/Eta of the trials
+// of its bracket that reached the rung. Until Eta trials reach the rung
+// there is not enough information and the trial is always promoted
+func promote(sweep *api.Sweep, trial *api.Trial, rung int) bool {
+	value := trial.Rungs[rung]
+
+	reached, better := 0, 0
+	for _, other := range sweep.Trials {
+		if other.Bracket != trial.Bracket || len(other.Rungs) <= rung {
+			continue
+		}
+		reached++
+		if isBetter(other.Rungs[rung], value, sweep.Request.Goal) {
+			better++
+		}
+	}
+
+	eta := sweep.Request.Pruning.Eta
+	if reached < eta {
+		return true
+	}
+	return better < reached/eta
+}
+
+// pruneTrial checks the live history of a running trial, saving the value
+// of the metric at the rungs it reached. If the trial is not promoted in
+// one of them it is stopped, and true is returned so its capacity
+// can be given to the pending trials
+func (r *Runner) pruneTrial(sweep *api.Sweep, trial *api.Trial) bool {
+	history, err := r.ps.JobHistory(trial.JobId)
+	if err != nil {
+		r.logger.Debug("Could not get the history of the trial",
+			zap.String("jobId", trial.JobId),
+			zap.Error(err))
+		return false
+	}
+
+	epochs := applyParameters(sweep.Request.Base, trial.Parameters).Epochs
+	points := rungs(sweep.Request.Pruning, trial.Bracket, epochs)
+
+	for len(trial.Rungs) < len(points) {
+		rung := len(trial.Rungs)
+		value, ok := metricAt(*history, sweep.Request.Metric, points[rung])
+		if !ok {
+			return false
+		}
+		trial.Rungs = append(trial.Rungs, value)
+
+		if promote(sweep, trial, rung) {
+			continue
+		}
+
+		if err := r.ps.StopTask(trial.JobId); err != nil {
+			r.logger.Error("Could not stop pruned trial",
+				zap.String("jobId", trial.JobId),
+				zap.Error(err))
+			// evaluate the rung again in the next check
+			trial.Rungs = trial.Rungs[:rung]
+			return false
+		}
+
+		r.logger.Info("Pruned trial",
+			zap.String("sweep", sweep.Id),
+			zap.String("jobId", trial.JobId),
+			zap.Int("epoch", points[rung]),
+			zap.Float64("metric", value))
+
+		trial.Status = api.StatusPruned
+		trial.Metric = &value
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,154 @@
+package sweep
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"reflect"
+	"testing"
+)
+
+func TestRungs(t *testing.T) {
+	tests := []struct {
+		name      string
+		minEpochs int
+		eta       int
+		bracket   int
+		epochs    int
+		want      []int
+	}{
+		{name: "first bracket", minEpochs: 1, eta: 3, bracket: 0, epochs: 10, want: []int{1, 3, 9}},
+		{name: "rung at the last epoch", minEpochs: 1, eta: 3, bracket: 0, epochs: 9, want: []int{1, 3}},
+		{name: "second bracket", minEpochs: 1, eta: 3, bracket: 1, epochs: 10, want: []int{3, 9}},
+		{name: "min epochs", minEpochs: 2, eta: 2, bracket: 0, epochs: 10, want: []int{2, 4, 8}},
+		{name: "single rung", minEpochs: 1, eta: 3, bracket: 0, epochs: 2, want: []int{1}},
+		{name: "no rungs", minEpochs: 1, eta: 3, bracket: 0, epochs: 1, want: nil},
+		{name: "bracket without rungs", minEpochs: 1, eta: 3, bracket: 3, epochs: 10, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &api.PruningOptions{MinEpochs: tt.minEpochs, Eta: tt.eta}
+			if got := rungs(opts, tt.bracket, tt.epochs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got rungs %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumBrackets(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		epochs int
+		want   int
+	}{
+		{name: "halving", policy: api.PruningHalving, epochs: 10, want: 1},
+		{name: "hyperband", policy: api.PruningHyperband, epochs: 10, want: 4},
+		{name: "hyperband single rung", policy: api.PruningHyperband, epochs: 2, want: 2},
+		{name: "hyperband without rungs", policy: api.PruningHyperband, epochs: 1, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &api.PruningOptions{Policy: tt.policy, MinEpochs: 1, Eta: 3}
+			if got := numBrackets(opts, tt.epochs); got != tt.want {
+				t.Errorf("got %v brackets, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignBrackets(t *testing.T) {
+	sweep := &api.Sweep{
+		Request: api.SweepRequest{
+			Base:    api.TrainRequest{Epochs: 10},
+			Pruning: &api.PruningOptions{Policy: api.PruningHyperband, MinEpochs: 1, Eta: 3},
+		},
+		Trials: make([]api.Trial, 6),
+	}
+
+	assignBrackets(sweep)
+
+	want := []int{0, 1, 2, 3, 0, 1}
+	for i, trial := range sweep.Trials {
+		if trial.Bracket != want[i] {
+			t.Errorf("trial %v got bracket %v, want %v", i, trial.Bracket, want[i])
+		}
+	}
+}
+
+func TestPromote(t *testing.T) {
+	tests := []struct {
+		name  string
+		goal  string
+		rungs [][]float64 // rungs reached by the other trials of the bracket
+		value float64
+		want  bool
+	}{
+		{
+			name:  "not enough trials",
+			goal:  api.GoalMaximize,
+			rungs: [][]float64{{0.9}},
+			value: 0.1,
+			want:  true,
+		},
+		{
+			name:  "best of eta",
+			goal:  api.GoalMaximize,
+			rungs: [][]float64{{0.5}, {0.1}},
+			value: 0.9,
+			want:  true,
+		},
+		{
+			name:  "second of eta",
+			goal:  api.GoalMaximize,
+			rungs: [][]float64{{0.9}, {0.1}},
+			value: 0.5,
+			want:  false,
+		},
+		{
+			name:  "second of twice eta",
+			goal:  api.GoalMaximize,
+			rungs: [][]float64{{0.9}, {0.4}, {0.3}, {0.2}, {0.1}},
+			value: 0.5,
+			want:  true,
+		},
+		{
+			name:  "minimize",
+			goal:  api.GoalMinimize,
+			rungs: [][]float64{{0.9}, {0.5}},
+			value: 0.1,
+			want:  true,
+		},
+		{
+			name:  "trials that did not reach the rung",
+			goal:  api.GoalMaximize,
+			rungs: [][]float64{{0.9}, {}, {}},
+			value: 0.5,
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sweep := &api.Sweep{
+				Request: api.SweepRequest{
+					Goal:    tt.goal,
+					Pruning: &api.PruningOptions{Eta: 3},
+				},
+			}
+			for _, r := range tt.rungs {
+				sweep.Trials = append(sweep.Trials, api.Trial{Rungs: r})
+			}
+			// a better trial of another bracket is not compared
+			sweep.Trials = append(sweep.Trials,
+				api.Trial{Bracket: 1, Rungs: []float64{1}},
+				api.Trial{Bracket: 1, Rungs: []float64{1}},
+				api.Trial{Rungs: []float64{tt.value}})
+			trial := &sweep.Trials[len(sweep.Trials)-1]
+
+			if got := promote(sweep, trial, 0); got != tt.want {
+				t.Errorf("got promote %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,477 @@
+package sweep
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	psClient "github.com/diegostock12/kubeml/ml/pkg/ps/client"
+	schedulerClient "github.com/diegostock12/kubeml/ml/pkg/scheduler/client"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// pollInterval is the time between checks of the trials of a sweep
+	pollInterval = 5 * time.Second
+
+	// startTimeout is the time a submitted trial can take to show
+	// up in the parameter server before it is considered failed
+	startTimeout = 5 * time.Minute
+
+	database          = "kubeml"
+	sweepCollection   = "sweeps"
+	historyCollection = "history"
+)
+
+type (
+
+	// Runner launches the trials of the sweeps through the scheduler, tracks
+	// them until they finish and keeps the state of the sweeps in the database
+	Runner struct {
+		logger      *zap.Logger
+		scheduler   *schedulerClient.Client
+		ps          *psClient.Client
+		mongoClient *mongo.Client
+
+		// running holds the stop channel of the sweeps currently running
+		running map[string]chan struct{}
+		mu      sync.Mutex
+	}
+
+	// trialTracker keeps the submit time of the trials and whether
+	// they were seen running in the parameter server
+	trialTracker struct {
+		submitted map[string]time.Time
+		seen      map[string]bool
+	}
+)
+
+// NewRunner creates the runner of the sweeps
+func NewRunner(
+	logger *zap.Logger,
+	scheduler *schedulerClient.Client,
+	ps *psClient.Client,
+	mongoClient *mongo.Client) *Runner {
+
+	return &Runner{
+		logger:      logger.Named("sweep-runner"),
+		scheduler:   scheduler,
+		ps:          ps,
+		mongoClient: mongoClient,
+		running:     make(map[string]chan struct{}),
+	}
+}
+
+// Create validates the request, builds the trials of the sweep and starts running them
+func (r *Runner) Create(req api.SweepRequest) (*api.Sweep, error) {
+	if err := ValidateRequest(&req); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sweep := &api.Sweep{
+		Id:      uuid.New().String()[:8],
+		Request: req,
+		Status:  api.StatusRunning,
+		Created: time.Now(),
+	}
+	if sweep.Request.Name == "" {
+		sweep.Request.Name = sweep.Id
+	}
+
+	for _, params := range buildTrials(req, rng) {
+		sweep.Trials = append(sweep.Trials, api.Trial{
+			Parameters: params,
+			Status:     api.StatusPending,
+		})
+	}
+
+	assignBrackets(sweep)
+
+	if err := r.save(sweep); err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("Created sweep",
+		zap.String("id", sweep.Id),
+		zap.String("strategy", req.Strategy),
+		zap.Int("trials", len(sweep.Trials)))
+
+	r.start(sweep)
+	return sweep, nil
+}
+
+// Get returns the sweep with the given id
+func (r *Runner) Get(id string) (*api.Sweep, error) {
+	var sweep api.Sweep
+	collection := r.mongoClient.Database(database).Collection(sweepCollection)
+	err := collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&sweep)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find sweep")
+	}
+
+	return &sweep, nil
+}
+
+// List returns all the sweeps in the database
+func (r *Runner) List() ([]api.Sweep, error) {
+	collection := r.mongoClient.Database(database).Collection(sweepCollection)
+	cursor, err := collection.Find(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list sweeps")
+	}
+
+	var sweeps []api.Sweep
+	err = cursor.All(context.TODO(), &sweeps)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not extract sweeps from cursor")
+	}
+
+	return sweeps, nil
+}
+
+// Stop stops all the running trials of a sweep and
+// prevents the pending ones from being launched
+func (r *Runner) Stop(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stop, exists := r.running[id]
+	if !exists {
+		return errors.New("sweep is not running")
+	}
+
+	close(stop)
+	delete(r.running, id)
+	return nil
+}
+
+// Resume restarts tracking the sweeps that were running in the
+// database, so sweeps survive restarts of the controller
+func (r *Runner) Resume() error {
+	collection := r.mongoClient.Database(database).Collection(sweepCollection)
+	cursor, err := collection.Find(context.TODO(), bson.M{"status": api.StatusRunning})
+	if err != nil {
+		return errors.Wrap(err, "could not list running sweeps")
+	}
+
+	var sweeps []api.Sweep
+	err = cursor.All(context.TODO(), &sweeps)
+	if err != nil {
+		return errors.Wrap(err, "could not extract sweeps from cursor")
+	}
+
+	for i := range sweeps {
+		r.logger.Info("Resuming sweep", zap.String("id", sweeps[i].Id))
+		r.start(&sweeps[i])
+	}
+
+	return nil
+}
+
+// start registers the sweep as running and launches its loop
+func (r *Runner) start(sweep *api.Sweep) {
+	stop := make(chan struct{})
+
+	r.mu.Lock()
+	r.running[sweep.Id] = stop
+	r.mu.Unlock()
+
+	go r.run(sweep, stop)
+}
+
+// run checks the trials of the sweep periodically until all of them
+// are finished or the sweep is stopped
+func (r *Runner) run(sweep *api.Sweep, stop chan struct{}) {
+	tracker := &trialTracker{
+		submitted: make(map[string]time.Time),
+		seen:      make(map[string]bool),
+	}
+
+	// trials running before a restart get the full timeout to show up
+	for _, trial := range sweep.Trials {
+		if trial.Status == api.StatusRunning {
+			tracker.submitted[trial.JobId] = time.Now()
+		}
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		done := r.step(sweep, tracker)
+		if err := r.save(sweep); err != nil {
+			r.logger.Error("Could not save sweep", zap.String("id", sweep.Id), zap.Error(err))
+		}
+
+		if done {
+			if sweep.Request.Strategy == api.SweepFolds {
+				if err := r.saveSummary(sweep); err != nil {
+					r.logger.Error("Could not save cross validation summary",
+						zap.String("id", sweep.Id),
+						zap.Error(err))
+				}
+			}
+
+			r.mu.Lock()
+			delete(r.running, sweep.Id)
+			r.mu.Unlock()
+
+			r.logger.Info("Sweep finished",
+				zap.String("id", sweep.Id),
+				zap.String("status", sweep.Status),
+				zap.String("best", sweep.BestTrial))
+			return
+		}
+
+		select {
+		case <-stop:
+			r.stopTrials(sweep)
+			if err := r.save(sweep); err != nil {
+				r.logger.Error("Could not save sweep", zap.String("id", sweep.Id), zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// step updates the status of the running trials and launches the pending
+// ones while under the concurrency limit. Returns true if the sweep is done
+func (r *Runner) step(sweep *api.Sweep, tracker *trialTracker) bool {
+	tasks, err := r.runningTasks()
+	if err != nil {
+		r.logger.Error("Could not get the running tasks", zap.Error(err))
+		return false
+	}
+	queued, err := r.queuedTasks()
+	if err != nil {
+		r.logger.Error("Could not get the queued tasks", zap.Error(err))
+		return false
+	}
+
+	running := 0
+	for i := range sweep.Trials {
+		trial := &sweep.Trials[i]
+		if trial.Status != api.StatusRunning {
+			continue
+		}
+
+		// queued trials count against the concurrency, and the start
+		// timeout only counts from the moment they leave the queue
+		if queued[trial.JobId] {
+			tracker.submitted[trial.JobId] = time.Now()
+			running++
+			continue
+		}
+
+		if tasks[trial.JobId] {
+			tracker.seen[trial.JobId] = true
+			if sweep.Request.Pruning != nil && r.pruneTrial(sweep, trial) {
+				continue
+			}
+			running++
+			continue
+		}
+
+		// the job is not in the parameter server, so it is either
+		// finished or still waiting to be started by the scheduler
+		history, err := r.fetchHistory(trial.JobId)
+		switch {
+		case err == nil && history.Status != api.StatusRunning:
+			r.completeTrial(sweep, trial, history)
+		case err == nil && tracker.seen[trial.JobId]:
+			trial.Status = api.StatusFailed
+			trial.Error = "job exited before finishing its training"
+		case tracker.seen[trial.JobId]:
+			trial.Status = api.StatusFailed
+			trial.Error = "job finished without saving its history"
+		case time.Since(tracker.submitted[trial.JobId]) > startTimeout:
+			trial.Status = api.StatusFailed
+			trial.Error = "job did not start"
+		default:
+			running++
+		}
+	}
+
+	pending := 0
+	for i := range sweep.Trials {
+		trial := &sweep.Trials[i]
+		if trial.Status != api.StatusPending {
+			continue
+		}
+		if running >= sweep.Request.Concurrency {
+			pending++
+			continue
+		}
+
+		r.submitTrial(sweep, trial, tracker)
+		if trial.Status == api.StatusRunning {
+			running++
+		}
+	}
+
+	if running > 0 || pending > 0 {
+		return false
+	}
+
+	// the sweep succeeds if at least one of the trials did
+	sweep.Status = api.StatusFailed
+	for _, trial := range sweep.Trials {
+		if trial.Status == api.StatusSucceeded {
+			sweep.Status = api.StatusSucceeded
+			break
+		}
+	}
+	return true
+}
+
+// submitTrial sends the train request of the trial to the scheduler
+func (r *Runner) submitTrial(sweep *api.Sweep, trial *api.Trial, tracker *trialTracker) {
+	req := applyParameters(sweep.Request.Base, trial.Parameters)
+
+	id, err := r.scheduler.SubmitTrainTask(req)
+	if err != nil {
+		r.logger.Error("Could not submit trial",
+			zap.String("sweep", sweep.Id),
+			zap.Error(err))
+		trial.Status = api.StatusFailed
+		trial.Error = err.Error()
+		return
+	}
+
+	r.logger.Debug("Submitted trial",
+		zap.String("sweep", sweep.Id),
+		zap.String("jobId", id),
+		zap.Any("parameters", trial.Parameters))
+
+	trial.JobId = id
+	trial.Status = api.StatusRunning
+	tracker.submitted[id] = time.Now()
+}
+
+// completeTrial saves the metric of a finished trial and
+// updates the best trial of the sweep
+func (r *Runner) completeTrial(sweep *api.Sweep, trial *api.Trial, history *api.History) {
+	switch history.Status {
+	case api.StatusFailed, api.StatusStopped:
+		trial.Status = history.Status
+		trial.Error = "job " + history.Status
+		return
+	}
+	trial.Status = api.StatusSucceeded
+
+	value, ok := metricValue(history.Data, sweep.Request.Metric)
+	if !ok {
+		trial.Error = "metric not found in the history"
+		return
+	}
+	trial.Metric = &value
+
+	best := r.bestMetric(sweep)
+	if best == nil || isBetter(value, *best, sweep.Request.Goal) {
+		sweep.BestTrial = trial.JobId
+	}
+}
+
+// bestMetric returns the metric of the best trial so far
+func (r *Runner) bestMetric(sweep *api.Sweep) *float64 {
+	for _, trial := range sweep.Trials {
+		if trial.JobId == sweep.BestTrial && sweep.BestTrial != "" {
+			return trial.Metric
+		}
+	}
+	return nil
+}
+
+// stopTrials stops the running trials through the parameter server,
+// cancels the ones still queued in the scheduler and marks the sweep as stopped
+func (r *Runner) stopTrials(sweep *api.Sweep) {
+	for i := range sweep.Trials {
+		trial := &sweep.Trials[i]
+		switch trial.Status {
+		case api.StatusRunning:
+			if err := r.scheduler.CancelJob(trial.JobId); err == nil {
+				trial.Status = api.StatusStopped
+				continue
+			}
+			if err := r.ps.StopTask(trial.JobId); err != nil {
+				r.logger.Error("Could not stop trial",
+					zap.String("jobId", trial.JobId),
+					zap.Error(err))
+			}
+			trial.Status = api.StatusStopped
+		case api.StatusPending:
+			trial.Status = api.StatusStopped
+		}
+	}
+
+	sweep.Status = api.StatusStopped
+	r.logger.Info("Sweep stopped", zap.String("id", sweep.Id))
+}
+
+// runningTasks returns the ids of the tasks running in the parameter server
+func (r *Runner) runningTasks() (map[string]bool, error) {
+	body, err := r.ps.ListTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []api.TrainTask
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal tasks")
+	}
+
+	ids := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		ids[task.Job.JobId] = true
+	}
+	return ids, nil
+}
+
+// queuedTasks returns the ids of the tasks waiting in the queue of the scheduler
+func (r *Runner) queuedTasks() (map[string]bool, error) {
+	tasks, err := r.scheduler.Queue()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		ids[task.Job.JobId] = true
+	}
+	return ids, nil
+}
+
+// fetchHistory returns the training history of a job
+func (r *Runner) fetchHistory(jobId string) (*api.History, error) {
+	var history api.History
+	collection := r.mongoClient.Database(database).Collection(historyCollection)
+	err := collection.FindOne(context.TODO(), bson.M{"_id": jobId}).Decode(&history)
+	if err != nil {
+		return nil, err
+	}
+
+	return &history, nil
+}
+
+// save replaces the sweep document in the database
+func (r *Runner) save(sweep *api.Sweep) error {
+	collection := r.mongoClient.Database(database).Collection(sweepCollection)
+	_, err := collection.ReplaceOne(context.TODO(),
+		bson.M{"_id": sweep.Id},
+		sweep,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.Wrap(err, "could not save sweep")
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package sweep
+
+import (
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Hyperparameters that can be tuned in a sweep
+const (
+	ParamLearningRate  = "lr"
+	ParamBatchSize     = "batch_size"
+	ParamK             = "k"
+	ParamEpochs        = "epochs"
+	ParamValidateEvery = "validate_every"
+	ParamFold          = "fold"
+)
+
+const defaultRandomTrials = 10
+
+// integerParams are the hyperparameters whose
+// sampled values are rounded
+var integerParams = map[string]bool{
+	ParamLearningRate:  false,
+	ParamBatchSize:     true,
+	ParamK:             true,
+	ParamEpochs:        true,
+	ParamValidateEvery: true,
+	ParamFold:          true,
+}
+
+// positiveParams are the hyperparameters that only
+// take values bigger than zero
+var positiveParams = map[string]bool{
+	ParamLearningRate: true,
+	ParamBatchSize:    true,
+	ParamK:            true,
+	ParamEpochs:       true,
+}
+
+// ValidateRequest checks the sweep request and its search
+// space and sets the default values of the optional fields
+func ValidateRequest(req *api.SweepRequest) error {
+	e := &multierror.Error{}
+
+	if req.Base.FunctionName == "" || req.Base.Dataset == "" {
+		e = multierror.Append(e, errors.New("base request needs a function and a dataset"))
+	}
+
+	if len(req.Parameters) == 0 {
+		e = multierror.Append(e, errors.New("sweep needs at least one parameter"))
+	}
+
+	if req.Strategy == "" {
+		req.Strategy = api.SweepGrid
+	}
+	if req.Strategy == api.SweepRandom && req.Trials <= 0 {
+		req.Trials = defaultRandomTrials
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = 1
+	}
+
+	if req.Metric == "" {
+		req.Metric = "accuracy"
+	}
+	if req.Goal == "" {
+		if req.Metric == "accuracy" {
+			req.Goal = api.GoalMaximize
+		} else {
+			req.Goal = api.GoalMinimize
+		}
+	}
+	if req.Goal != api.GoalMaximize && req.Goal != api.GoalMinimize {
+		e = multierror.Append(e, fmt.Errorf("unknown goal \"%v\"", req.Goal))
+	}
+
+	for name, param := range req.Parameters {
+		if _, exists := integerParams[name]; !exists {
+			e = multierror.Append(e, fmt.Errorf("unknown parameter \"%v\"", name))
+			continue
+		}
+
+		if param.Values != nil && len(param.Values) == 0 {
+			e = multierror.Append(e, fmt.Errorf("parameter \"%v\" has an empty list of values", name))
+			continue
+		}
+		if err := validateSpace(name, param, req.Strategy); err != nil {
+			e = multierror.Append(e, err)
+		}
+
+		switch req.Strategy {
+		case api.SweepGrid, api.SweepFolds:
+			if len(param.Values) == 0 {
+				e = multierror.Append(e, fmt.Errorf("parameter \"%v\" needs values for a grid sweep", name))
+			}
+		case api.SweepRandom:
+			if len(param.Values) == 0 && param.Min >= param.Max {
+				e = multierror.Append(e, fmt.Errorf("parameter \"%v\" needs values or a range", name))
+			}
+			if len(param.Values) == 0 && param.Log && param.Min <= 0 {
+				e = multierror.Append(e, fmt.Errorf("parameter \"%v\" needs a positive range to be log sampled", name))
+			}
+		}
+	}
+
+	switch req.Strategy {
+	case api.SweepGrid, api.SweepRandom:
+	case api.SweepFolds:
+		if req.Base.Options.Folds < 2 {
+			e = multierror.Append(e, errors.New("cross validation needs at least 2 folds"))
+		}
+	default:
+		e = multierror.Append(e, fmt.Errorf("unknown strategy \"%v\"", req.Strategy))
+	}
+
+	if req.Pruning != nil {
+		if err := validatePruning(req); err != nil {
+			e = multierror.Append(e, err)
+		}
+	}
+
+	return e.ErrorOrNil()
+}
+
+// validateSpace checks that the values a parameter can take in the
+// sweep are valid for it once rounded, only the values are used by the
+// grid sweeps while the random sweeps sample from the range if not set
+func validateSpace(name string, param api.SweepParameter, strategy string) error {
+	if !positiveParams[name] {
+		return nil
+	}
+
+	positive := func(value float64) bool {
+		if integerParams[name] {
+			value = math.Round(value)
+		}
+		return value > 0
+	}
+
+	for _, value := range param.Values {
+		if !positive(value) {
+			return fmt.Errorf("parameter \"%v\" should be bigger than zero, got %v", name, value)
+		}
+	}
+	if len(param.Values) == 0 && strategy == api.SweepRandom && !positive(param.Min) {
+		return fmt.Errorf("the range of parameter \"%v\" should be bigger than zero", name)
+	}
+
+	return nil
+}
+
+// validatePruning checks the pruning options and sets their defaults
+func validatePruning(req *api.SweepRequest) error {
+	e := &multierror.Error{}
+	opts := req.Pruning
+
+	if opts.Policy == "" {
+		opts.Policy = api.PruningHalving
+	}
+	if opts.Policy != api.PruningHalving && opts.Policy != api.PruningHyperband {
+		e = multierror.Append(e, fmt.Errorf("unknown pruning policy \"%v\"", opts.Policy))
+	}
+
+	if opts.Eta == 0 {
+		opts.Eta = defaultEta
+	}
+	if opts.Eta < 2 {
+		e = multierror.Append(e, errors.New("pruning eta must be at least 2"))
+	}
+
+	if opts.MinEpochs == 0 {
+		opts.MinEpochs = defaultMinEpochs
+	}
+	if opts.MinEpochs < 1 {
+		e = multierror.Append(e, errors.New("pruning min epochs must be positive"))
+	}
+
+	// validation metrics are only available if the trials validate during training
+	_, swept := req.Parameters[ParamValidateEvery]
+	if (req.Metric == "accuracy" || req.Metric == "validation_loss") &&
+		req.Base.Options.ValidateEvery <= 0 && !swept {
+		e = multierror.Append(e, fmt.Errorf("pruning on \"%v\" needs validate_every to be set", req.Metric))
+	}
+
+	return e.ErrorOrNil()
+}
+
+// buildTrials returns the parameters of each of the trials of the sweep
+func buildTrials(req api.SweepRequest, rng *rand.Rand) []map[string]float64 {
+	var trials []map[string]float64
+	switch req.Strategy {
+	case api.SweepRandom:
+		trials = randomTrials(req.Parameters, req.Trials, rng)
+	default:
+		trials = gridTrials(req.Parameters)
+	}
+
+	// round the values of the integer parameters
+	for _, params := range trials {
+		for name, value := range params {
+			if integerParams[name] {
+				params[name] = math.Round(value)
+			}
+		}
+	}
+
+	return trials
+}
+
+// gridTrials returns the cartesian product of the values of the parameters
+func gridTrials(params map[string]api.SweepParameter) []map[string]float64 {
+	names := sortedNames(params)
+
+	trials := []map[string]float64{{}}
+	for _, name := range names {
+		var expanded []map[string]float64
+		for _, trial := range trials {
+			for _, value := range params[name].Values {
+				next := make(map[string]float64, len(trial)+1)
+				for k, v := range trial {
+					next[k] = v
+				}
+				next[name] = value
+				expanded = append(expanded, next)
+			}
+		}
+		trials = expanded
+	}
+
+	return trials
+}
+
+// randomTrials samples n configurations from the search space
+func randomTrials(params map[string]api.SweepParameter, n int, rng *rand.Rand) []map[string]float64 {
+	names := sortedNames(params)
+
+	trials := make([]map[string]float64, n)
+	for i := range trials {
+		trials[i] = make(map[string]float64, len(names))
+		for _, name := range names {
+			trials[i][name] = sample(params[name], rng)
+		}
+	}
+
+	return trials
+}
+
+// sample picks one of the values of the parameter or, if not
+// set, a value from its range, uniformly or in log scale
+func sample(param api.SweepParameter, rng *rand.Rand) float64 {
+	if len(param.Values) > 0 {
+		return param.Values[rng.Intn(len(param.Values))]
+	}
+
+	if param.Log {
+		low, high := math.Log(param.Min), math.Log(param.Max)
+		return math.Exp(low + rng.Float64()*(high-low))
+	}
+	return param.Min + rng.Float64()*(param.Max-param.Min)
+}
+
+// sortedNames returns the names of the parameters sorted so
+// the trials are generated in the same order every time
+func sortedNames(params map[string]api.SweepParameter) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
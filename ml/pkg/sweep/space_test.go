@@ -0,0 +1,175 @@
+package sweep
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"math/rand"
+	"testing"
+)
+
+func TestValidateRequestSpace(t *testing.T) {
+	base := api.TrainRequest{FunctionName: "net", Dataset: "mnist"}
+
+	tests := []struct {
+		name     string
+		strategy string
+		params   map[string]api.SweepParameter
+		valid    bool
+	}{
+		{
+			name:     "grid",
+			strategy: api.SweepGrid,
+			params: map[string]api.SweepParameter{
+				ParamLearningRate: {Values: []float64{0.1, 0.01}},
+				ParamBatchSize:    {Values: []float64{32, 64}},
+			},
+			valid: true,
+		},
+		{
+			name:     "zero batch size",
+			strategy: api.SweepGrid,
+			params:   map[string]api.SweepParameter{ParamBatchSize: {Values: []float64{0, 64}}},
+		},
+		{
+			name:     "batch size rounded to zero",
+			strategy: api.SweepGrid,
+			params:   map[string]api.SweepParameter{ParamBatchSize: {Values: []float64{0.4}}},
+		},
+		{
+			name:     "negative learning rate",
+			strategy: api.SweepGrid,
+			params:   map[string]api.SweepParameter{ParamLearningRate: {Values: []float64{-0.1}}},
+		},
+		{
+			name:     "empty choices",
+			strategy: api.SweepRandom,
+			params:   map[string]api.SweepParameter{ParamLearningRate: {Values: []float64{}, Min: 0.1, Max: 1}},
+		},
+		{
+			name:     "positive range",
+			strategy: api.SweepRandom,
+			params:   map[string]api.SweepParameter{ParamLearningRate: {Min: 0.001, Max: 0.1, Log: true}},
+			valid:    true,
+		},
+		{
+			name:     "range from zero",
+			strategy: api.SweepRandom,
+			params:   map[string]api.SweepParameter{ParamLearningRate: {Min: 0, Max: 0.1}},
+		},
+		{
+			name:     "range ignored in grid",
+			strategy: api.SweepGrid,
+			params:   map[string]api.SweepParameter{ParamBatchSize: {Values: []float64{16}, Min: -1, Max: 1}},
+			valid:    true,
+		},
+		{
+			name:     "validate every can be zero",
+			strategy: api.SweepGrid,
+			params:   map[string]api.SweepParameter{ParamValidateEvery: {Values: []float64{0, 1}}},
+			valid:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := api.SweepRequest{Base: base, Strategy: tt.strategy, Parameters: tt.params}
+			err := ValidateRequest(&req)
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestGridTrials(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]api.SweepParameter
+		trials int
+	}{
+		{name: "no parameters", params: map[string]api.SweepParameter{}, trials: 1},
+		{
+			name:   "single parameter",
+			params: map[string]api.SweepParameter{ParamK: {Values: []float64{1, 2, 4}}},
+			trials: 3,
+		},
+		{
+			name: "cartesian product",
+			params: map[string]api.SweepParameter{
+				ParamK:            {Values: []float64{1, 2, 4}},
+				ParamLearningRate: {Values: []float64{0.1, 0.01}},
+			},
+			trials: 6,
+		},
+		{
+			name: "empty grid",
+			params: map[string]api.SweepParameter{
+				ParamK:            {Values: []float64{1, 2}},
+				ParamLearningRate: {},
+			},
+			trials: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trials := gridTrials(tt.params)
+			if len(trials) != tt.trials {
+				t.Fatalf("got %v trials, want %v", len(trials), tt.trials)
+			}
+
+			seen := make(map[[2]float64]bool)
+			for _, trial := range trials {
+				if len(trial) != len(tt.params) {
+					t.Errorf("trial %v does not set all the parameters", trial)
+				}
+				key := [2]float64{trial[ParamK], trial[ParamLearningRate]}
+				if seen[key] {
+					t.Errorf("trial %v is repeated", trial)
+				}
+				seen[key] = true
+			}
+		})
+	}
+}
+
+func TestBuildTrialsRandom(t *testing.T) {
+	params := map[string]api.SweepParameter{
+		ParamLearningRate: {Min: 0.001, Max: 0.1, Log: true},
+		ParamBatchSize:    {Min: 16, Max: 128},
+		ParamK:            {Values: []float64{1, 2, 4}},
+	}
+
+	tests := []struct {
+		name   string
+		trials int
+	}{
+		{name: "no samples", trials: 0},
+		{name: "single sample", trials: 1},
+		{name: "many samples", trials: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := api.SweepRequest{Strategy: api.SweepRandom, Trials: tt.trials, Parameters: params}
+			trials := buildTrials(req, rand.New(rand.NewSource(1)))
+			if len(trials) != tt.trials {
+				t.Fatalf("got %v trials, want %v", len(trials), tt.trials)
+			}
+
+			for _, trial := range trials {
+				if lr := trial[ParamLearningRate]; lr < 0.001 || lr > 0.1 {
+					t.Errorf("learning rate %v out of range", lr)
+				}
+				if b := trial[ParamBatchSize]; b < 16 || b > 128 || b != float64(int(b)) {
+					t.Errorf("batch size %v is not a rounded value of the range", b)
+				}
+				if k := trial[ParamK]; k != 1 && k != 2 && k != 4 {
+					t.Errorf("k %v is not one of the values", k)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package sweep
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+)
+
+// applyParameters returns the base train request with the
+// hyperparameters of the trial set
+func applyParameters(base api.TrainRequest, params map[string]float64) api.TrainRequest {
+	req := base
+	for name, value := range params {
+		switch name {
+		case ParamLearningRate:
+			req.LearningRate = float32(value)
+		case ParamBatchSize:
+			req.BatchSize = int(value)
+		case ParamK:
+			req.Options.K = int(value)
+		case ParamEpochs:
+			req.Epochs = int(value)
+		case ParamValidateEvery:
+			req.Options.ValidateEvery = int(value)
+		case ParamFold:
+			req.Options.Fold = int(value)
+		}
+	}
+
+	return req
+}
+
+// metricValue returns the last value of the metric in the history. Besides
+// the accuracy and losses, the metric can be any of the custom metrics
+// returned by the functions, looking first at the validation ones
+func metricValue(history api.JobHistory, metric string) (float64, bool) {
+	series, _ := metricSeries(history, metric)
+	if len(series) == 0 {
+		return 0, false
+	}
+	return series[len(series)-1], true
+}
+
+// metricAt returns the value of the metric once the job reached the given epoch.
+// Validation metrics take the first validation done at or after the epoch,
+// while train metrics have a value per epoch
+func metricAt(history api.JobHistory, metric string, epoch int) (float64, bool) {
+	series, validation := metricSeries(history, metric)
+	if !validation {
+		if epoch < 1 || len(series) < epoch {
+			return 0, false
+		}
+		return series[epoch-1], true
+	}
+
+	for i, e := range history.ValidationEpochs {
+		if e >= epoch && i < len(series) {
+			return series[i], true
+		}
+	}
+	return 0, false
+}
+
+// metricSeries returns the series of the metric in the history
+// and whether it is computed in the validation
+func metricSeries(history api.JobHistory, metric string) ([]float64, bool) {
+	switch metric {
+	case "accuracy":
+		return history.Accuracy, true
+	case "validation_loss":
+		return history.ValidationLoss, true
+	case "train_loss":
+		return history.TrainLoss, false
+	default:
+		if values, exists := history.ValidationMetrics[metric]; exists {
+			return values, true
+		}
+		return history.TrainMetrics[metric], false
+	}
+}
+
+// isBetter returns true if the value improves the best one given the goal
+func isBetter(value, best float64, goal string) bool {
+	if goal == api.GoalMinimize {
+		return value < best
+	}
+	return value > best
+}
@@ -0,0 +1,76 @@
+package train
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+	"math"
+)
+
+// adaptK is called at the end of each epoch once the model is merged.
+// It saves the divergence between the models of the functions during the epoch
+// and, if an adaptive K policy is configured, sets the K used in the next epoch
+func (job *TrainJob) adaptK() {
+	var divergence float64
+	if job.divergenceRounds > 0 {
+		divergence = job.divergence / float64(job.divergenceRounds)
+	}
+	job.historyMu.Lock()
+	job.history.Divergence = append(job.history.Divergence, divergence)
+	job.historyMu.Unlock()
+
+	// K = -1 means syncing once per epoch, which is not adapted
+	opts := job.adaptiveK
+	if opts == nil || job.K <= 0 {
+		return
+	}
+
+	k := job.K
+	switch opts.Policy {
+	case api.AdaptiveKSchedule:
+		if opts.Every > 0 && job.epoch%opts.Every == 0 {
+			k = scaleK(k, opts.Factor)
+		}
+
+	case api.AdaptiveKDivergence:
+		switch {
+		case divergence > opts.Threshold:
+			k = scaleK(k, 1/opts.Factor)
+		case divergence < opts.Threshold/2:
+			k = scaleK(k, opts.Factor)
+		}
+
+	default:
+		return
+	}
+
+	k = clampK(k, opts)
+	if k != job.K {
+		job.logger.Info("Changing K",
+			zap.String("policy", opts.Policy),
+			zap.Int("old", job.K),
+			zap.Int("new", k),
+			zap.Float64("divergence", divergence))
+		job.K = k
+	}
+}
+
+// scaleK multiplies K by the factor, keeping it positive
+func scaleK(k int, factor float64) int {
+	scaled := int(math.Round(float64(k) * factor))
+	if scaled < 1 {
+		return 1
+	}
+	return scaled
+}
+
+// clampK keeps K between the limits of the policy,
+// a MaxK of zero means K has no upper limit
+func clampK(k int, opts *api.AdaptiveKOptions) int {
+	if k < opts.MinK {
+		k = opts.MinK
+	}
+	if opts.MaxK > 0 && k > opts.MaxK {
+		k = opts.MaxK
+	}
+	return k
+}
@@ -0,0 +1,67 @@
+package train
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestAdaptK(t *testing.T) {
+	schedule := &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 1, Factor: 2, Every: 2}
+	divergence := &api.AdaptiveKOptions{Policy: api.AdaptiveKDivergence, MinK: 2, MaxK: 16, Factor: 2, Threshold: 1}
+
+	tests := []struct {
+		name       string
+		opts       *api.AdaptiveKOptions
+		k          int
+		epoch      int
+		divergence float64
+		rounds     int
+		want       int
+	}{
+		{name: "static", opts: nil, k: 4, epoch: 2, divergence: 2, rounds: 4, want: 4},
+		{name: "once per epoch", opts: schedule, k: -1, epoch: 2, want: -1},
+		{name: "schedule", opts: schedule, k: 4, epoch: 4, want: 8},
+		{name: "schedule between steps", opts: schedule, k: 4, epoch: 3, want: 4},
+		{
+			name:  "schedule max",
+			opts:  &api.AdaptiveKOptions{Policy: api.AdaptiveKSchedule, MinK: 1, MaxK: 6, Factor: 2, Every: 1},
+			k:     4,
+			epoch: 1,
+			want:  6,
+		},
+		{name: "high divergence", opts: divergence, k: 8, divergence: 6, rounds: 4, want: 4},
+		{name: "low divergence", opts: divergence, k: 8, divergence: 0.8, rounds: 4, want: 16},
+		{name: "stable divergence", opts: divergence, k: 8, divergence: 3, rounds: 4, want: 8},
+		{name: "min k", opts: divergence, k: 3, divergence: 6, rounds: 4, want: 2},
+		{name: "max k", opts: divergence, k: 12, divergence: 0.8, rounds: 4, want: 16},
+		{name: "no merge rounds", opts: divergence, k: 4, want: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &TrainJob{
+				logger:           zap.NewNop(),
+				K:                tt.k,
+				epoch:            tt.epoch,
+				adaptiveK:        tt.opts,
+				divergence:       tt.divergence,
+				divergenceRounds: tt.rounds,
+			}
+
+			job.adaptK()
+
+			if job.K != tt.want {
+				t.Errorf("got K %v, want %v", job.K, tt.want)
+			}
+
+			var want float64
+			if tt.rounds > 0 {
+				want = tt.divergence / float64(tt.rounds)
+			}
+			if d := job.history.Divergence; len(d) != 1 || d[0] != want {
+				t.Errorf("got divergence history %v, want [%v]", d, want)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 // finishNotification is received by the merger
@@ -16,6 +18,18 @@ import (
 type finishNotification struct {
 	funcId   int
 	respChan chan MergeResult
+
+	// running loss and number of samples reported
+	// by the function in the iteration
+	loss    float64
+	samples int
+}
+
+// iterationReport is the optional payload sent by the functions
+// when syncing with the job
+type iterationReport struct {
+	Loss    float64 `json:"loss"`
+	Samples int     `json:"samples"`
 }
 
 type MergeResult int
@@ -49,6 +63,15 @@ func (job *TrainJob) startTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// move the job out of pending so the task
+	// cannot be started twice
+	if err := job.transition(api.PhaseInitializing); err != nil {
+		job.logger.Warn("Received task for job already started",
+			zap.String("phase", string(job.currentPhase())))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
 	// initialize variables used during training
 	job.extractTaskSettings(task)
 
@@ -58,7 +81,6 @@ func (job *TrainJob) startTask(w http.ResponseWriter, r *http.Request) {
 	job.logger.Debug("Assigned new task to the job",
 		zap.Any("task", task))
 
-	// TODO have a running boolean to prevent us from starting another task
 	go job.Train()
 
 	w.WriteHeader(http.StatusOK)
@@ -66,7 +88,7 @@ func (job *TrainJob) startTask(w http.ResponseWriter, r *http.Request) {
 
 // updateTask receives updates from the scheduler with new parameters such as
 // parallelism to be applied in the new epochs
-func (job TrainJob) updateTask(w http.ResponseWriter, r *http.Request) {
+func (job *TrainJob) updateTask(w http.ResponseWriter, r *http.Request) {
 
 	job.logger.Debug("Updating task")
 
@@ -101,10 +123,33 @@ func (job *TrainJob) nextIteration(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	funcId, _ := strconv.Atoi(vars["funcId"])
 
+	// count the sync for the function breakdown of the epoch
+	if funcId >= 0 && funcId < len(job.syncs) {
+		atomic.AddInt64(&job.syncs[funcId], 1)
+	}
+
+	// read the running loss of the function if it was sent
+	var report iterationReport
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		job.logger.Warn("Could not read iteration report", zap.Error(err))
+	} else if len(body) > 0 {
+		if err = json.Unmarshal(body, &report); err != nil {
+			job.logger.Warn("Could not unmarshal iteration report",
+				zap.String("request", string(body)),
+				zap.Error(err))
+		}
+	}
+
 	// communicate that this function has finished and wait for the
 	// merger to respond once finished
 	respChan := make(chan MergeResult, 1)
-	job.finishCh <- &finishNotification{funcId, respChan}
+	job.finishCh <- &finishNotification{
+		funcId:   funcId,
+		respChan: respChan,
+		loss:     report.Loss,
+		samples:  report.Samples,
+	}
 
 	// trigger model update
 	job.model.Update(funcId)
@@ -127,6 +172,13 @@ func (job *TrainJob) nextIteration(w http.ResponseWriter, r *http.Request) {
 
 // stop stops the training task
 func (job *TrainJob) stop(w http.ResponseWriter, r *http.Request) {
+	if err := job.requestStop(); err != nil {
+		job.logger.Warn("Could not stop job", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	job.recordEvent(api.EventStopRequested, "", nil)
 	job.logger.Debug("Api sending stop to the channel")
 	job.stopChan <- struct{}{}
 	w.WriteHeader(http.StatusOK)
@@ -134,6 +186,141 @@ func (job *TrainJob) stop(w http.ResponseWriter, r *http.Request) {
 }
 
 
+// updateHyperparameters receives new hyperparameters for the job,
+// which are applied at the start of the next epoch
+func (job *TrainJob) updateHyperparameters(w http.ResponseWriter, r *http.Request) {
+
+	var update api.HyperparameterUpdate
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		job.logger.Error("Could not read request body",
+			zap.Error(err))
+		http.Error(w, "could not read request body", http.StatusInternalServerError)
+		return
+	}
+
+	err = json.Unmarshal(body, &update)
+	if err != nil {
+		job.logger.Error("Could not unmarshal the update json",
+			zap.String("request", string(body)),
+			zap.Error(err))
+		http.Error(w, "could not unmarshal update", http.StatusBadRequest)
+		return
+	}
+
+	if err := job.requestHyperparameters(update); err != nil {
+		job.logger.Warn("Could not update hyperparameters", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	job.logger.Debug("Hyperparameters will be applied in the next epoch",
+		zap.Any("update", update))
+	w.WriteHeader(http.StatusOK)
+}
+
+// pause makes the job wait before the next epoch until it is resumed
+func (job *TrainJob) pause(w http.ResponseWriter, r *http.Request) {
+	if err := job.requestPause(); err != nil {
+		job.logger.Warn("Could not pause job", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	job.recordEvent(api.EventPause, "pause requested", nil)
+	job.logger.Debug("Job will pause after the current epoch")
+	w.WriteHeader(http.StatusOK)
+}
+
+// preempt records the preemption of the job by another job of higher
+// priority. A job scaled down gets its new parallelism from the scheduler
+// at the end of the epoch, while a job paused waits until it is resumed
+func (job *TrainJob) preempt(w http.ResponseWriter, r *http.Request) {
+	var preemption api.Preemption
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		job.logger.Error("Could not read request body", zap.Error(err))
+		http.Error(w, "could not read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err = json.Unmarshal(body, &preemption); err != nil {
+		job.logger.Error("Could not unmarshal the preemption", zap.Error(err))
+		http.Error(w, "could not unmarshal preemption", http.StatusBadRequest)
+		return
+	}
+
+	var message string
+	switch preemption.Action {
+	case api.PreemptScaleDown:
+		message = fmt.Sprintf("scaled down to %d functions by job %v with %v priority",
+			preemption.Parallelism, preemption.JobId, preemption.Priority)
+	case api.PreemptPause:
+		if err := job.requestPause(); err != nil {
+			job.logger.Warn("Could not pause preempted job", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		message = fmt.Sprintf("paused by job %v with %v priority", preemption.JobId, preemption.Priority)
+	default:
+		http.Error(w, fmt.Sprintf("unknown preemption action %v", preemption.Action), http.StatusBadRequest)
+		return
+	}
+
+	job.logger.Info("Job preempted", zap.String("action", preemption.Action), zap.String("by", preemption.JobId))
+	job.recordEvent(api.EventPreemption, message, map[string]interface{}{
+		"action":      preemption.Action,
+		"parallelism": preemption.Parallelism,
+		"job_id":      preemption.JobId,
+	})
+
+	job.stateMu.Lock()
+	epoch := job.phaseEpoch
+	job.stateMu.Unlock()
+
+	job.historyMu.Lock()
+	job.history.Events = append(job.history.Events, api.HistoryEvent{
+		Epoch:     epoch,
+		Timestamp: time.Now(),
+		Type:      api.EventPreemption,
+		Message:   message,
+	})
+	job.historyMu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// resume lets a paused job continue with the training
+func (job *TrainJob) resume(w http.ResponseWriter, r *http.Request) {
+	if err := job.requestResume(); err != nil {
+		job.logger.Warn("Could not resume job", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	job.recordEvent(api.EventResume, "resume requested", nil)
+	job.logger.Debug("Resuming job")
+	w.WriteHeader(http.StatusOK)
+}
+
+// getHistory returns the history of the job up to the current epoch,
+// so the progress of the training can be followed before it is saved
+func (job *TrainJob) getHistory(w http.ResponseWriter, r *http.Request) {
+	job.historyMu.RLock()
+	resp, err := json.Marshal(job.history)
+	job.historyMu.RUnlock()
+
+	if err != nil {
+		job.logger.Error("Could not marshal history", zap.Error(err))
+		http.Error(w, "could not marshal history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
 func (job *TrainJob) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
@@ -144,6 +331,11 @@ func (job *TrainJob) GetHandler() http.Handler {
 	r.HandleFunc("/update", job.updateTask).Methods("POST")
 	r.HandleFunc("/next/{funcId}", job.nextIteration).Methods("POST")
 	r.HandleFunc("/stop", job.stop).Methods("DELETE")
+	r.HandleFunc("/pause", job.pause).Methods("POST")
+	r.HandleFunc("/hyperparams", job.updateHyperparameters).Methods("POST")
+	r.HandleFunc("/resume", job.resume).Methods("POST")
+	r.HandleFunc("/preempt", job.preempt).Methods("POST")
+	r.HandleFunc("/history", job.getHistory).Methods("GET")
 	r.HandleFunc("/health", job.handleHealth).Methods("GET")
 	return r
 }
@@ -53,6 +53,112 @@ func (c *Client) Stop(task *api.TrainTask) error {
 	return nil
 }
 
+// UpdateHyperparameters sends the new hyperparameters to the TrainJob
+func (c *Client) UpdateHyperparameters(task *api.TrainTask, update api.HyperparameterUpdate) error {
+	svcName := task.Job.Svc.Name
+	url := fmt.Sprintf("http://%v/hyperparams", svcName)
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal hyperparameters")
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not send hyperparameters to job")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+	return nil
+}
+
+// Preempt tells the job that it was preempted by a job of higher priority
+func (c *Client) Preempt(task *api.TrainTask, preemption api.Preemption) error {
+	svcName := task.Job.Svc.Name
+	url := fmt.Sprintf("http://%v/preempt", svcName)
+
+	body, err := json.Marshal(preemption)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal preemption")
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not send preemption to job")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+	return nil
+}
+
+// Pause makes the job wait before the next epoch until it is resumed
+func (c *Client) Pause(task *api.TrainTask) error {
+	return c.sendCommand(task, "pause")
+}
+
+// Resume lets a paused job continue training
+func (c *Client) Resume(task *api.TrainTask) error {
+	return c.sendCommand(task, "resume")
+}
+
+// sendCommand posts an empty request to the given endpoint
+// of the job and returns the error message if it fails
+func (c *Client) sendCommand(task *api.TrainTask, command string) error {
+	svcName := task.Job.Svc.Name
+	url := fmt.Sprintf("http://%v/%v", svcName, command)
+
+	resp, err := c.httpClient.Post(url, "text/plain", nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not send %v to job", command)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		res, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return errors.New(string(res))
+	}
+	return nil
+}
+
+// History returns the history of the job up to the current epoch
+func (c *Client) History(task *api.TrainTask) ([]byte, error) {
+	svcName := task.Job.Svc.Name
+	url := fmt.Sprintf("http://%v/history", svcName)
+
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get history from job")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read response body")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(body))
+	}
+	return body, nil
+}
+
 // UpdateTask sends the updated parameters to the TrainJob
 func (c *Client) UpdateTask(task *api.TrainTask, update api.JobState) error {
 	svcName := task.Job.Svc.Name
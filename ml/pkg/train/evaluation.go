@@ -0,0 +1,230 @@
+package train
+
+import (
+	"encoding/json"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	kerror "github.com/diegostock12/kubeml/ml/pkg/error"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// maxEvalClasses bounds the classes of the confusion matrix, so a wrong
+// label returned by a function does not allocate a huge matrix
+const maxEvalClasses = 1000
+
+// evaluationResults are the per-class counts returned by an evaluation
+// function. Each entry of the confusion holds the true class, the
+// predicted class and the number of samples with that combination
+type evaluationResults struct {
+	Length    int      `json:"length"`
+	Confusion [][3]int `json:"confusion"`
+}
+
+// evaluate invokes the evaluation functions on the test set with the
+// final model, and saves the report built from their counts in the history
+func (job *TrainJob) evaluate() error {
+	// the evaluation usually follows the final validation,
+	// so the job might already be validating
+	if job.currentPhase() != api.PhaseValidating {
+		if err := job.transition(api.PhaseValidating); err != nil {
+			return errors.Wrap(err, "could not start the evaluation")
+		}
+	}
+
+	results, err := job.invokeEvalFunctions()
+	if err != nil {
+		return errors.Wrap(err, "error during evaluation")
+	}
+
+	report, ignored := buildReport(results)
+	if ignored > 0 {
+		job.logger.Warn("Ignored evaluation counts with invalid classes",
+			zap.Int("samples", ignored),
+			zap.Int("maxClasses", maxEvalClasses))
+	}
+	job.recordEvent(api.EventEvaluation, "", map[string]interface{}{
+		"samples":  report.Samples,
+		"accuracy": report.Accuracy,
+		"macro_f1": report.MacroF1,
+	})
+
+	job.historyMu.Lock()
+	job.report = report
+	job.historyMu.Unlock()
+
+	job.logger.Info("Final evaluation finished",
+		zap.Int("samples", report.Samples),
+		zap.Float64("accuracy", report.Accuracy),
+		zap.Float64("macroF1", report.MacroF1))
+
+	return nil
+}
+
+// invokeEvalFunctions invokes the evaluation functions with the parallelism of
+// the job, each of them evaluating a part of the test set, and returns the
+// results of the ones that succeeded
+func (job *TrainJob) invokeEvalFunctions() ([]*evaluationResults, error) {
+
+	n := job.parallelism
+	wg := &sync.WaitGroup{}
+	respChan := make(chan *evaluationResults, n)
+	errChan := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		job.logger.Debug("Invoking evaluation function", zap.Int("id", i))
+		funcUrl := job.buildFunctionURL(FunctionArgs{Id: i, Num: n}, Evaluation)
+		go job.launchEvalFunction(i, funcUrl, wg, respChan, errChan)
+	}
+	wg.Wait()
+	close(respChan)
+
+	var results []*evaluationResults
+	for res := range respChan {
+		results = append(results, res)
+	}
+
+	switch {
+	case len(results) == 0:
+		select {
+		case funcError := <-errChan:
+			return nil, errors.Wrap(funcError, "all functions finished with an error")
+		default:
+			return nil, errors.New("all functions returned an unknown error")
+		}
+	case len(results) < n:
+		job.logger.Warn("Some of the functions returned without a result",
+			zap.Int("functions", n),
+			zap.Int("responses", len(results)))
+	}
+
+	return results, nil
+}
+
+// launchEvalFunction calls an evaluation function and sends its counts to the response channel
+func (job *TrainJob) launchEvalFunction(
+	funcId int,
+	funcUrl string,
+	wg *sync.WaitGroup,
+	respChan chan *evaluationResults,
+	errChan chan error) {
+
+	defer wg.Done()
+
+	fail := func(err error) {
+		job.recordEvent(api.EventFunctionError, err.Error(), map[string]interface{}{
+			"func_id": funcId,
+			"task":    string(Evaluation),
+		})
+		errChan <- err
+	}
+
+	resp, err := http.Get(funcUrl)
+	if err != nil {
+		job.logger.Error("Error when performing request",
+			zap.Int("funcId", funcId),
+			zap.Error(err))
+		fail(err)
+		return
+	}
+
+	if err = kerror.CheckFunctionError(resp); err != nil {
+		fail(err)
+		return
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		fail(errors.Wrap(err, "unable to read response body"))
+		return
+	}
+
+	var res evaluationResults
+	if err = json.Unmarshal(body, &res); err != nil {
+		fail(errors.Wrap(err, "could not parse evaluation results"))
+		return
+	}
+
+	respChan <- &res
+}
+
+// buildReport merges the counts of the functions in a confusion matrix,
+// sized by the largest class seen, and computes the metrics of each class.
+// Counts with negative classes or classes over the limit are ignored, and
+// the number of samples ignored is returned along with the report
+func buildReport(results []*evaluationResults) (*api.EvaluationReport, int) {
+	valid := func(c [3]int) bool {
+		return c[0] >= 0 && c[1] >= 0 && c[0] < maxEvalClasses && c[1] < maxEvalClasses
+	}
+
+	classes := 0
+	for _, res := range results {
+		for _, c := range res.Confusion {
+			if !valid(c) {
+				continue
+			}
+			if c[0] >= classes {
+				classes = c[0] + 1
+			}
+			if c[1] >= classes {
+				classes = c[1] + 1
+			}
+		}
+	}
+
+	confusion := make([][]int, classes)
+	for i := range confusion {
+		confusion[i] = make([]int, classes)
+	}
+
+	report := &api.EvaluationReport{Confusion: confusion}
+	ignored := 0
+	for _, res := range results {
+		for _, c := range res.Confusion {
+			if !valid(c) {
+				ignored += c[2]
+				continue
+			}
+			confusion[c[0]][c[1]] += c[2]
+			report.Samples += c[2]
+		}
+	}
+
+	var correct int
+	for class := 0; class < classes; class++ {
+		var predicted, support int
+		for other := 0; other < classes; other++ {
+			predicted += confusion[other][class]
+			support += confusion[class][other]
+		}
+		tp := confusion[class][class]
+		correct += tp
+
+		m := api.ClassMetrics{Class: class, Support: support}
+		if predicted > 0 {
+			m.Precision = float64(tp) / float64(predicted)
+		}
+		if support > 0 {
+			m.Recall = float64(tp) / float64(support)
+		}
+		if m.Precision+m.Recall > 0 {
+			m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+
+		report.Classes = append(report.Classes, m)
+		report.MacroF1 += m.F1
+	}
+
+	if classes > 0 {
+		report.MacroF1 /= float64(classes)
+	}
+	if report.Samples > 0 {
+		report.Accuracy = 100 * float64(correct) / float64(report.Samples)
+	}
+
+	return report, ignored
+}
@@ -0,0 +1,76 @@
+package train
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBuildReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  []*evaluationResults
+		samples  int
+		ignored  int
+		classes  int
+		accuracy float64
+		macroF1  float64
+	}{
+		{
+			name: "no samples",
+		},
+		{
+			name: "perfect",
+			results: []*evaluationResults{
+				{Confusion: [][3]int{{0, 0, 5}, {1, 1, 5}}},
+			},
+			samples: 10, classes: 2, accuracy: 100, macroF1: 1,
+		},
+		{
+			name: "counts of several functions",
+			results: []*evaluationResults{
+				{Confusion: [][3]int{{0, 0, 3}, {0, 1, 1}}},
+				{Confusion: [][3]int{{1, 1, 4}, {1, 0, 2}}},
+			},
+			// class 0: precision 3/5, recall 3/4, class 1: precision 4/5, recall 4/6
+			samples: 10, classes: 2, accuracy: 70,
+			macroF1: (2*0.6*0.75/(0.6+0.75) + 2*0.8*(4.0/6)/(0.8+4.0/6)) / 2,
+		},
+		{
+			name: "class never predicted",
+			results: []*evaluationResults{
+				{Confusion: [][3]int{{0, 0, 2}, {2, 0, 2}}},
+			},
+			// class 0: precision 1/2, recall 1, classes 1 and 2 score zero
+			samples: 4, classes: 3, accuracy: 50, macroF1: 2 * 0.5 / 1.5 / 3,
+		},
+		{
+			name: "invalid classes are ignored",
+			results: []*evaluationResults{
+				{Confusion: [][3]int{{0, 0, 4}, {-1, 0, 2}, {0, maxEvalClasses, 3}}},
+			},
+			samples: 4, ignored: 5, classes: 1, accuracy: 100, macroF1: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, ignored := buildReport(tt.results)
+
+			if report.Samples != tt.samples {
+				t.Errorf("got %v samples, want %v", report.Samples, tt.samples)
+			}
+			if ignored != tt.ignored {
+				t.Errorf("got %v ignored samples, want %v", ignored, tt.ignored)
+			}
+			if len(report.Confusion) != tt.classes || len(report.Classes) != tt.classes {
+				t.Errorf("got %v classes, want %v", len(report.Classes), tt.classes)
+			}
+			if math.Abs(report.Accuracy-tt.accuracy) > 1e-9 {
+				t.Errorf("got accuracy %v, want %v", report.Accuracy, tt.accuracy)
+			}
+			if math.Abs(report.MacroF1-tt.macroF1) > 1e-9 {
+				t.Errorf("got macro F1 %v, want %v", report.MacroF1, tt.macroF1)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package train
+
+import (
+	"context"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	// eventBuffer is the number of events that can be queued
+	// before new ones are dropped
+	eventBuffer = 512
+
+	// eventBatch is the maximum number of events inserted at once
+	eventBatch = 64
+)
+
+// eventWriter saves the timeline of the job in the database. The events
+// are queued and written by a separate goroutine, so recording them never
+// blocks the training
+type eventWriter struct {
+	logger *zap.Logger
+	events chan interface{}
+	done   chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// newEventWriter creates the writer and starts the goroutine that saves the events
+func newEventWriter(logger *zap.Logger) *eventWriter {
+	w := &eventWriter{
+		logger: logger.Named("events"),
+		events: make(chan interface{}, eventBuffer),
+		done:   make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// record queues the event, dropping it if the queue is full
+func (w *eventWriter) record(event api.JobEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.events <- event:
+	default:
+		w.logger.Warn("Event queue is full, dropping event",
+			zap.String("type", event.Type))
+	}
+}
+
+// close waits until the queued events are written
+func (w *eventWriter) close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.events)
+	w.mu.Unlock()
+
+	<-w.done
+}
+
+// run inserts the events in the database as they are queued,
+// grouping the ones that are already waiting in a single write
+func (w *eventWriter) run() {
+	defer close(w.done)
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(createMongoURI()))
+	if err == nil {
+		err = client.Connect(context.TODO())
+	}
+	if err != nil {
+		w.logger.Error("Could not connect to mongo, events will not be saved", zap.Error(err))
+		for range w.events {
+		}
+		return
+	}
+	defer client.Disconnect(context.TODO())
+
+	collection := client.Database("kubeml").Collection("events")
+	for event := range w.events {
+		batch := []interface{}{event}
+
+	queued:
+		for len(batch) < eventBatch {
+			select {
+			case e, ok := <-w.events:
+				if !ok {
+					break queued
+				}
+				batch = append(batch, e)
+			default:
+				break queued
+			}
+		}
+
+		if _, err := collection.InsertMany(context.TODO(), batch); err != nil {
+			w.logger.Error("Could not save events", zap.Int("events", len(batch)), zap.Error(err))
+		}
+	}
+}
+
+// recordEvent adds an event to the timeline of the job
+func (job *TrainJob) recordEvent(eventType, message string, details map[string]interface{}) {
+	job.events.record(api.JobEvent{
+		JobId:     job.jobId,
+		Timestamp: time.Now(),
+		Epoch:     job.cappedEpoch(),
+		Type:      eventType,
+		Message:   message,
+		Details:   details,
+	})
+}
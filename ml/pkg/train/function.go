@@ -1,16 +1,20 @@
 package train
 
 import (
+	"fmt"
 	"github.com/diegostock12/kubeml/ml/pkg/api"
 	kerror "github.com/diegostock12/kubeml/ml/pkg/error"
 	"github.com/diegostock12/kubeml/ml/pkg/util"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"hash/fnv"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type (
@@ -19,8 +23,14 @@ type (
 	// the url of a function, such as the function id and
 	// parallelism level
 	FunctionArgs struct {
-		Id  int
-		Num int
+		Id     int
+		Num    int
+		Shards []api.Shard
+
+		// Fraction of the test set validated, the sample chosen
+		// is the same for all the functions of a validation
+		Fraction float64
+		Sample   int
 	}
 
 	// FunctionResults holds the function id and the execution
@@ -30,6 +40,14 @@ type (
 		results map[string]float64
 	}
 
+	// validationArgs holds the number of functions of a validation,
+	// the fraction of the test set they validate and the sample taken
+	validationArgs struct {
+		parallelism int
+		fraction    float64
+		sample      int
+	}
+
 	FunctionTask string
 )
 
@@ -38,6 +56,7 @@ const (
 	Validation FunctionTask = "val"
 	Init       FunctionTask = "init"
 	Inference  FunctionTask = "infer"
+	Evaluation FunctionTask = "eval"
 )
 
 // buildFunctionURL returns the url that the PS will invoke to execute the function
@@ -56,9 +75,31 @@ func (job *TrainJob) buildFunctionURL(args FunctionArgs, task FunctionTask) stri
 	values.Set("N", strconv.Itoa(args.Num))
 	values.Set("K", strconv.Itoa(job.K))
 	values.Set("funcId", strconv.Itoa(args.Id))
-	values.Set("batchSize", strconv.Itoa(job.task.Parameters.BatchSize))
-	values.Set("lr", strconv.FormatFloat(float64(job.task.Parameters.LearningRate), 'f', -1, 32))
-	values.Set("epoch", strconv.Itoa(job.epoch)) // add epoch to be able to train with step lr
+	values.Set("batchSize", strconv.Itoa(job.batchSize))
+	values.Set("lr", strconv.FormatFloat(float64(job.lr), 'f', -1, 32))
+	values.Set("epoch", strconv.Itoa(job.currentEpoch())) // add epoch to be able to train with step lr
+
+	// the documents of the dataset assigned to the function
+	if len(args.Shards) > 0 {
+		values.Set("shard", formatShards(args.Shards))
+	}
+
+	// the sample of the test set to validate on
+	if args.Fraction > 0 && args.Fraction < 1 {
+		values.Set("fraction", strconv.FormatFloat(args.Fraction, 'f', -1, 64))
+		values.Set("sample", strconv.Itoa(args.Sample))
+	}
+
+	// the seed of the invocation if the training is reproducible
+	if job.task.Parameters.Options.Seed != nil {
+		values.Set("seed", strconv.FormatUint(uint64(job.functionSeed(task, args.Id)), 10))
+	}
+
+	// the fold held out for validation in cross validation runs
+	if opts := job.task.Parameters.Options; opts.Folds > 1 {
+		values.Set("folds", strconv.Itoa(opts.Folds))
+		values.Set("fold", strconv.Itoa(opts.Fold))
+	}
 
 	dest := routerAddr + "/" + job.task.Parameters.FunctionName + "?" + values.Encode()
 
@@ -67,6 +108,15 @@ func (job *TrainJob) buildFunctionURL(args FunctionArgs, task FunctionTask) stri
 	return dest
 }
 
+// functionSeed derives the seed of a function invocation from the seed of the
+// job, so each task, epoch and function gets a different but reproducible seed.
+// It is kept in 32 bits so it can be used to seed every library in the functions
+func (job *TrainJob) functionSeed(task FunctionTask, funcId int) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%s/%d/%d", *job.task.Parameters.Options.Seed, task, job.epoch, funcId)
+	return h.Sum32()
+}
+
 // invokeInitFunction calls a single function which initializes the
 // model, saves it to the database and returns the layer names that the job will save
 func (job *TrainJob) invokeInitFunction() ([]string, error) {
@@ -98,19 +148,20 @@ func (job *TrainJob) invokeInitFunction() ([]string, error) {
 
 }
 
-// invokeTrainFunctions Invokes N functions to start the next epoch
-// returns the function ids from which it got a response
-func (job *TrainJob) invokeTrainFunctions() (float64, []int, error) {
+// invokeTrainFunctions Invokes a function for each of the shards to train in
+// the epoch and returns the results of the functions that succeeded
+func (job *TrainJob) invokeTrainFunctions(shards [][]api.Shard) ([]*FunctionResults, error) {
 
+	n := len(shards)
 	wg := &sync.WaitGroup{}
-	respChan := make(chan *FunctionResults, job.parallelism)
-	errChan := make(chan error, job.parallelism)
+	respChan := make(chan *FunctionResults, n)
+	errChan := make(chan error, n)
 
-	for i := 0; i < job.parallelism; i++ {
+	for i := 0; i < n; i++ {
 		wg.Add(1)
 
 		job.logger.Debug("Invoking function", zap.Int("id", i))
-		args := FunctionArgs{Id: i, Num: job.parallelism}
+		args := FunctionArgs{Id: i, Num: n, Shards: shards[i]}
 		funcUrl := job.buildFunctionURL(args, Train)
 		go job.launchFunction(i, funcUrl, Train, wg, respChan, errChan)
 	}
@@ -118,30 +169,27 @@ func (job *TrainJob) invokeTrainFunctions() (float64, []int, error) {
 
 	// check that at least some functions returned without errors
 	if err := job.checkFunctionErrors(respChan, errChan); err != nil {
-		return 0, nil, err
+		return nil, err
 	}
 
-	// get the average loss
-	loss, funcs := getAverageLoss(respChan)
-
-	return loss, funcs, nil
+	return collectResults(respChan), nil
 }
 
 // invokeValFunctions After getting all the gradients and publishing the new model invoke
 // the validations functions to get the performance of the system, these are returned as a dict
 // containing the accuracy, loss and number of datapoints processed by each of the functions.
 //
-// Returns the accuracy and loss of the functions
-func (job *TrainJob) invokeValFunctions() (float64, float64, error) {
+// Returns the accuracy, loss and custom metrics of the functions
+func (job *TrainJob) invokeValFunctions(v validationArgs) (float64, float64, map[string]float64, error) {
 
 	wg := &sync.WaitGroup{}
-	respChan := make(chan *FunctionResults, job.parallelism)
-	errChan := make(chan error, job.parallelism)
+	respChan := make(chan *FunctionResults, v.parallelism)
+	errChan := make(chan error, v.parallelism)
 
-	for i := 0; i < job.parallelism; i++ {
+	for i := 0; i < v.parallelism; i++ {
 		wg.Add(1)
 		job.logger.Debug("Invoking validation function", zap.Int("id", i))
-		args := FunctionArgs{Id: i, Num: job.parallelism}
+		args := FunctionArgs{Id: i, Num: v.parallelism, Fraction: v.fraction, Sample: v.sample}
 		funcUrl := job.buildFunctionURL(args, Validation)
 		go job.launchFunction(i, funcUrl, Validation, wg, respChan, errChan)
 	}
@@ -149,18 +197,21 @@ func (job *TrainJob) invokeValFunctions() (float64, float64, error) {
 
 	// check that at least some functions returned without errors
 	if err := job.checkFunctionErrors(respChan, errChan); err != nil {
-		return 0, 0, err
+		return 0, 0, nil, err
 	}
 
-	accuracy, loss, total := getValidationMetrics(respChan)
+	results := collectResults(respChan)
+	accuracy, loss, total := getValidationMetrics(results)
+	metrics := aggregateMetrics(results, job.task.Parameters.Options.MetricAggregation)
 
 	// Update the history with the new results
 	job.logger.Debug("Got validation results",
 		zap.Float64("accuracy", accuracy),
 		zap.Float64("loss", loss),
-		zap.Float64("total points", total))
+		zap.Float64("total points", total),
+		zap.Any("metrics", metrics))
 
-	return accuracy, loss, nil
+	return accuracy, loss, metrics, nil
 
 }
 
@@ -191,12 +242,42 @@ func (job *TrainJob) launchFunction(
 
 	defer wg.Done()
 
+	// keep a record of the train functions with their duration,
+	// syncs and results for the per-function breakdown of the history
+	var record *api.FunctionRecord
+	if task == Train {
+		record = &api.FunctionRecord{
+			Epoch:    job.epoch,
+			FuncId:   funcId,
+			Shards:   job.roundShards[funcId],
+			Recovery: job.recovery,
+		}
+		start := time.Now()
+		defer func() {
+			record.Duration = time.Since(start).Seconds()
+			record.Syncs = int(atomic.LoadInt64(&job.syncs[funcId]))
+			job.addFunctionRecord(*record)
+		}()
+	}
+
+	// fail reports the error of the function
+	fail := func(err error) {
+		if record != nil {
+			record.Error = err.Error()
+		}
+		job.recordEvent(api.EventFunctionError, err.Error(), map[string]interface{}{
+			"func_id": funcId,
+			"task":    string(task),
+		})
+		errChan <- err
+	}
+
 	resp, err := http.Get(funcUrl)
 	if err != nil {
 		job.logger.Error("Error when performing request",
 			zap.Int("funcId", funcId),
 			zap.Error(err))
-		errChan <- err
+		fail(err)
 		return
 	}
 
@@ -205,13 +286,13 @@ func (job *TrainJob) launchFunction(
 	// Check if we got a KubeML error in the response, if so return it in the error chan
 	if err = kerror.CheckFunctionError(resp); err != nil {
 		job.logger.Debug("returning error...", zap.Error(err))
-		errChan <- err
+		fail(err)
 		return
 	}
 
 	res, err := parseFunctionResults(resp)
 	if err != nil {
-		errChan <- err
+		fail(err)
 		return
 	}
 
@@ -219,9 +300,37 @@ func (job *TrainJob) launchFunction(
 		zap.Int("funcId", funcId),
 		zap.Any("results", res))
 
+	if record != nil {
+		record.Loss = res["loss"]
+		record.Samples = int(res["length"])
+	}
+
 	respChan <- &FunctionResults{
 		funcId:  funcId,
 		results: res,
 	}
 
 }
+
+// addFunctionRecord saves the record of a finished train function
+func (job *TrainJob) addFunctionRecord(record api.FunctionRecord) {
+	job.recordsMu.Lock()
+	defer job.recordsMu.Unlock()
+
+	job.records = append(job.records, record)
+}
+
+// functionRecords returns the records of the functions of
+// the current epoch sorted by function id
+func (job *TrainJob) functionRecords() []api.FunctionRecord {
+	job.recordsMu.Lock()
+	defer job.recordsMu.Unlock()
+
+	records := make([]api.FunctionRecord, len(job.records))
+	copy(records, job.records)
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].FuncId < records[j].FuncId
+	})
+
+	return records
+}
@@ -0,0 +1,137 @@
+package train
+
+import (
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+	"math"
+	"time"
+)
+
+// requestHyperparameters saves the update so it is applied at the start
+// of the next epoch. Updates received during the same epoch are merged,
+// with the latest value of each field taking precedence
+func (job *TrainJob) requestHyperparameters(update api.HyperparameterUpdate) error {
+	job.stateMu.Lock()
+	defer job.stateMu.Unlock()
+
+	switch job.phase {
+	case api.PhaseInitializing, api.PhaseTraining, api.PhaseMerging,
+		api.PhaseValidating, api.PhasePaused:
+	default:
+		return fmt.Errorf("job cannot be updated while %v", job.phase)
+	}
+
+	if job.pendingUpdate == nil {
+		job.pendingUpdate = &api.HyperparameterUpdate{}
+	}
+	mergeHyperparameters(job.pendingUpdate, update)
+
+	return nil
+}
+
+// applyHyperparameters sets the pending hyperparameters in the job
+// and records the change in the history
+func (job *TrainJob) applyHyperparameters() {
+	job.stateMu.Lock()
+	update := job.pendingUpdate
+	job.pendingUpdate = nil
+	job.stateMu.Unlock()
+
+	if update == nil {
+		return
+	}
+
+	if update.LearningRate != nil {
+		job.lr = *update.LearningRate
+	}
+	if update.K != nil {
+		job.K = *update.K
+	}
+	if update.BatchSize != nil {
+		job.batchSize = *update.BatchSize
+	}
+	if update.LearningRate != nil || update.BatchSize != nil {
+		job.rebaseHyperparameters()
+	}
+	if update.ValidateEvery != nil {
+		job.validateEvery = *update.ValidateEvery
+	}
+	if update.GoalAccuracy != nil {
+		job.goalAccuracy = *update.GoalAccuracy
+	}
+
+	job.logger.Info("Applied new hyperparameters",
+		zap.Int("epoch", job.epoch),
+		zap.Any("update", update))
+
+	job.recordEvent(api.EventHyperparameters, "", map[string]interface{}{
+		"update": update,
+	})
+
+	job.historyMu.Lock()
+	job.history.Events = append(job.history.Events, api.HistoryEvent{
+		Epoch:           job.epoch,
+		Timestamp:       time.Now(),
+		Type:            api.EventHyperparameters,
+		Hyperparameters: update,
+	})
+	job.historyMu.Unlock()
+}
+
+// rebaseHyperparameters takes the current batch size, lr and parallelism
+// as the reference for the rescaling done when the parallelism changes
+func (job *TrainJob) rebaseHyperparameters() {
+	job.baseBatchSize = job.batchSize
+	job.baseLr = job.lr
+	job.baseParallelism = job.parallelism
+}
+
+// rescaleHyperparameters adapts the batch size or the lr to the
+// current parallelism following the scaling mode of the job
+func (job *TrainJob) rescaleHyperparameters() {
+	if job.baseParallelism <= 0 || job.parallelism <= 0 {
+		return
+	}
+
+	switch job.scaling {
+	case api.ScalingConstantBatch:
+		// keep the global batch of the base parallelism
+		global := job.baseBatchSize * job.baseParallelism
+		job.batchSize = int(math.Round(float64(global) / float64(job.parallelism)))
+		if job.batchSize < 1 {
+			job.batchSize = 1
+		}
+
+	case api.ScalingLinearLr:
+		job.lr = job.baseLr * float32(job.parallelism) / float32(job.baseParallelism)
+
+	default:
+		return
+	}
+
+	job.logger.Debug("Rescaled hyperparameters",
+		zap.String("scaling", job.scaling),
+		zap.Int("parallelism", job.parallelism),
+		zap.Int("batchSize", job.batchSize),
+		zap.Float32("lr", job.lr))
+}
+
+// mergeHyperparameters copies the fields set in the update to dst
+func mergeHyperparameters(dst *api.HyperparameterUpdate, update api.HyperparameterUpdate) {
+	if update.LearningRate != nil {
+		dst.LearningRate = update.LearningRate
+	}
+	if update.K != nil {
+		dst.K = update.K
+	}
+	if update.BatchSize != nil {
+		dst.BatchSize = update.BatchSize
+	}
+	if update.ValidateEvery != nil {
+		dst.ValidateEvery = update.ValidateEvery
+	}
+	if update.GoalAccuracy != nil {
+		dst.GoalAccuracy = update.GoalAccuracy
+	}
+}
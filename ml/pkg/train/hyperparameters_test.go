@@ -0,0 +1,51 @@
+package train
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestRescaleHyperparameters(t *testing.T) {
+	tests := []struct {
+		name            string
+		scaling         string
+		baseParallelism int
+		parallelism     int
+		batchSize       int
+		lr              float32
+	}{
+		{name: "none", scaling: api.ScalingNone, baseParallelism: 2, parallelism: 4, batchSize: 64, lr: 0.1},
+		{name: "constant batch up", scaling: api.ScalingConstantBatch, baseParallelism: 2, parallelism: 4, batchSize: 32, lr: 0.1},
+		{name: "constant batch down", scaling: api.ScalingConstantBatch, baseParallelism: 4, parallelism: 2, batchSize: 128, lr: 0.1},
+		{name: "constant batch rounded", scaling: api.ScalingConstantBatch, baseParallelism: 2, parallelism: 3, batchSize: 43, lr: 0.1},
+		{name: "constant batch at least one", scaling: api.ScalingConstantBatch, baseParallelism: 1, parallelism: 256, batchSize: 1, lr: 0.1},
+		{name: "linear lr", scaling: api.ScalingLinearLr, baseParallelism: 2, parallelism: 4, batchSize: 64, lr: 0.2},
+		{name: "unknown base", scaling: api.ScalingLinearLr, baseParallelism: 0, parallelism: 4, batchSize: 64, lr: 0.1},
+		{name: "no functions", scaling: api.ScalingConstantBatch, baseParallelism: 2, parallelism: 0, batchSize: 64, lr: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &TrainJob{
+				logger:          zap.NewNop(),
+				scaling:         tt.scaling,
+				batchSize:       64,
+				lr:              0.1,
+				parallelism:     tt.parallelism,
+				baseBatchSize:   64,
+				baseLr:          0.1,
+				baseParallelism: tt.baseParallelism,
+			}
+
+			job.rescaleHyperparameters()
+
+			if job.batchSize != tt.batchSize {
+				t.Errorf("got batch size %v, want %v", job.batchSize, tt.batchSize)
+			}
+			if job.lr != tt.lr {
+				t.Errorf("got lr %v, want %v", job.lr, tt.lr)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/diegostock12/kubeml/ml/pkg/util"
 	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	"sync"
 	"sync/atomic"
@@ -27,6 +28,15 @@ type TrainJob struct {
 	ps        *psClient.Client
 	redisPool *redis.Pool //goroutines will fetch new connections from this pool to update the model in parallel
 
+	// mongoClient saves the history, it is connected the first time
+	// the history is saved. mongoMu guards it, since the history is
+	// saved both by the train loop and the validation goroutines
+	mongoClient *mongo.Client
+	mongoMu     sync.Mutex
+
+	// events saves the timeline of the job
+	events *eventWriter
+
 	// Training-specific resources
 	history   api.JobHistory
 	task      *api.TrainTask
@@ -35,12 +45,48 @@ type TrainJob struct {
 	model     *model.Model
 	optimizer model.ParallelSGD
 
-	// options of the trainjob
+	// options of the trainjob, batch size and lr are
+	// the effective ones that are sent to the functions
+	batchSize     int
+	lr            float32
 	parallelism   int
+	scaling       string
 	static        bool
 	validateEvery int
 	K             int
 	goalAccuracy  float64 // validation accuracy that marks the stop moment
+	adaptiveK     *api.AdaptiveKOptions
+
+	// validation options, the fraction of the test set validated, the
+	// number of validation functions and the merge rounds between validations
+	valFraction         float64
+	valParallelism      int
+	validateEveryRounds int
+
+	// merge rounds of the whole training, used to validate every few
+	// rounds. Only one validation runs at a time and the ones started by
+	// the merger are skipped while the previous one is still running
+	mergeRounds     int
+	validations     int
+	roundValidating int32
+	valMu           sync.Mutex
+	wgValidation    sync.WaitGroup
+
+	// the loss of the merge rounds is sent to the parameter server
+	// outside of the merger, one update at a time
+	publishingIteration int32
+	wgMetrics           sync.WaitGroup
+
+	// base values from which the batch size and lr are
+	// rescaled when the parallelism changes
+	baseBatchSize   int
+	baseLr          float32
+	baseParallelism int
+
+	// sum of the divergences of the merge rounds of the
+	// epoch, used by the adaptive K policies
+	divergence       float64
+	divergenceRounds int
 
 	// channel to receive updates from the scheduler
 	// through the api
@@ -62,6 +108,42 @@ type TrainJob struct {
 	finishCh      chan *finishNotification
 	merged        chan struct{}
 
+	// documents of the train set split in shards among the functions,
+	// the shards of the current round and whether it retrains the
+	// shards of failed functions. numDocs is zero if the count failed
+	// and the functions choose their data from their id
+	numDocs     int
+	roundShards [][]api.Shard
+	roundFuncs  int
+	recovery    bool
+
+	// per-function bookkeeping of the current epoch, the number
+	// of syncs of each function and the records of the finished ones
+	syncs     []int64
+	records   []api.FunctionRecord
+	recordsMu sync.Mutex
+
+	// historyMu guards the history and the report of the final
+	// evaluation, which are read through the api while the training loop updates them
+	historyMu sync.RWMutex
+	report    *api.EvaluationReport
+
+	// lifecycle of the job, the phase is changed by the training
+	// loop and the stop requests received through the api
+	phase          api.JobPhase
+	phaseEpoch     int
+	lastTransition time.Time
+	stateMu        sync.Mutex
+
+	// hyperparameters received through the api, applied
+	// at the start of the next epoch
+	pendingUpdate *api.HyperparameterUpdate
+
+	// pauseRequested makes the job wait for the
+	// resume signal after the current epoch
+	pauseRequested bool
+	resumeCh       chan struct{}
+
 	// keep track of the start time to compute stats
 	startTime time.Time
 
@@ -93,6 +175,10 @@ func NewTrainJob(
 		wgIteration: &sync.WaitGroup{},
 		merged:      make(chan struct{}),
 		stopChan:    make(chan struct{}, 1),
+		resumeCh:    make(chan struct{}, 1),
+		// the job is created along with its task, so
+		// it is initializing from the beginning
+		phase: api.PhaseInitializing,
 	}
 
 	// extract the settings from the task
@@ -106,6 +192,7 @@ func NewTrainJob(
 	}
 	job.ps = psClient.MakeClient(job.logger, psUrl)
 	job.optimizer = model.MakeParallelSGD(job.logger)
+	job.events = newEventWriter(job.logger)
 
 	return job
 
@@ -129,8 +216,11 @@ func NewBasicJob(logger *zap.Logger, jobId string) *TrainJob {
 		wgIteration: &sync.WaitGroup{},
 		merged:      make(chan struct{}),
 		stopChan:    make(chan struct{}, 1),
+		resumeCh:    make(chan struct{}, 1),
+		phase:       api.PhasePending,
 	}
 
+	job.events = newEventWriter(job.logger)
 	job.scheduler = schedulerClient.MakeClient(job.logger, api.SchedulerUrl)
 	job.ps = psClient.MakeClient(job.logger, api.ParameterServerUrl)
 	job.optimizer = model.MakeParallelSGD(job.logger)
@@ -142,10 +232,18 @@ func NewBasicJob(logger *zap.Logger, jobId string) *TrainJob {
 func (job *TrainJob) extractTaskSettings(task api.TrainTask) {
 	job.task = &task
 	job.parallelism = task.Job.State.Parallelism
+	job.batchSize = task.Parameters.BatchSize
+	job.lr = task.Parameters.LearningRate
 	job.static = task.Parameters.Options.StaticParallelism
 	job.validateEvery = task.Parameters.Options.ValidateEvery
+	job.valFraction = task.Parameters.Options.ValidationFraction
+	job.valParallelism = task.Parameters.Options.ValidationParallelism
+	job.validateEveryRounds = task.Parameters.Options.ValidateEveryRounds
 	job.K = task.Parameters.Options.K
 	job.goalAccuracy = task.Parameters.Options.GoalAccuracy
+	job.adaptiveK = task.Parameters.Options.AdaptiveK
+	job.scaling = task.Parameters.Options.Scaling
+	job.rebaseHyperparameters()
 }
 
 // Train is the main
@@ -159,16 +257,39 @@ func (job *TrainJob) Train() {
 	job.logger.Info("Initializing model")
 
 	defer func() {
+		// wait for the validations and metric updates started by the merger
+		job.wgValidation.Wait()
+		job.wgMetrics.Wait()
+
 		// After the job is finished
 		// unregister the prometheus exposed metrics,
 		// clear connections and send the finish signal to the parameter
 		// server
+		job.finish()
+		status := job.historyStatus()
+		job.saveHistory(status)
+		job.closeHistory()
+
+		var message string
+		if job.exitErr != nil {
+			message = job.exitErr.Error()
+		}
+		job.recordEvent(api.EventFinished, message, map[string]interface{}{"status": status})
+		job.events.close()
+
 		job.clearTensors()
 		job.redisPool.Close()
 		job.logger.Debug("closing job", zap.Error(job.exitErr))
 		job.ps.JobFinished(job.jobId, job.exitErr)
 	}()
 
+	job.recordEvent(api.EventTaskReceived, "", map[string]interface{}{
+		"parallelism": job.parallelism,
+		"epochs":      job.task.Parameters.Epochs,
+		"function":    job.task.Parameters.FunctionName,
+		"dataset":     job.task.Parameters.Dataset,
+	})
+
 	// Call the init function and build the reference model,
 	// fatal if it fails
 	err := job.init()
@@ -178,12 +299,19 @@ func (job *TrainJob) Train() {
 		job.exitErr = err
 		return
 	}
+	job.recordEvent(api.EventInitDone, "", map[string]interface{}{
+		"layers":    len(job.model.StateDict),
+		"documents": job.numDocs,
+	})
 
 	// Main training loop
 	job.startTime = time.Now()
 
 main:
-	for job.epoch = 1; job.epoch <= job.task.Parameters.Epochs; job.epoch++ {
+	for job.setEpoch(1); job.epoch <= job.task.Parameters.Epochs; job.setEpoch(job.epoch + 1) {
+
+		// apply the hyperparameters received during the last epoch
+		job.applyHyperparameters()
 
 		err := job.train()
 		if err != nil {
@@ -191,6 +319,7 @@ main:
 			job.exitErr = err
 			return
 		}
+		job.transition(api.PhaseMerging)
 
 		// If we need, ask the scheduler for updated settings
 		if !job.static && job.epoch < job.task.Parameters.Epochs {
@@ -205,11 +334,17 @@ main:
 			job.logger.Info("Received next config from the Scheduler",
 				zap.Int("new parallelism", update.Parallelism))
 
+			job.recordEvent(api.EventParallelism, "", map[string]interface{}{
+				"current": job.parallelism,
+				"next":    update.Parallelism,
+			})
+
 			// Get the new parallelism and update it in the history
-			job.task.Job.State = *update
+			job.task.Job.State.Parallelism = update.Parallelism
 			if !util.IsDebugEnv() && !util.LimitParallelism() {
 				job.logger.Debug("updating parallelism...")
 				job.parallelism = update.Parallelism
+				job.rescaleHyperparameters()
 			}
 
 		}
@@ -218,12 +353,15 @@ main:
 		job.logger.Debug("Waiting for merge to complete...")
 		<-job.merged
 
+		// choose the K for the next epoch
+		job.adaptK()
+
 		// Trigger validation if configured
 		if job.validateEvery != 0 &&
 			job.epoch%job.validateEvery == 0 &&
 			job.epoch != job.task.Parameters.Epochs {
 
-			err = job.validate()
+			err = job.validate(false)
 			if err != nil {
 				job.logger.Error("error performing validation",
 					zap.Error(err))
@@ -243,21 +381,35 @@ main:
 			break main
 		default:
 		}
+
+		// wait before the next epoch if the job is paused
+		if job.epoch != job.task.Parameters.Epochs && !job.pauseIfRequested() {
+			job.logger.Debug("Job stopping while paused...")
+			job.accuracyReached = true
+			job.exitErr = errors.New("job was force stopped")
+			break main
+		}
 	}
 
 	// if the accuracy is already reached, no need to
 	// validate again
+	job.wgValidation.Wait()
 	if !job.accuracyReached {
-		err = job.validate()
+		err = job.validate(true)
 		if err != nil {
 			job.logger.Error("error performing validation",
 				zap.Error(err))
 		}
 	}
 
-	// Wait for the val functions to finish if there
-	// are still some running
-	job.saveTrainingHistory()
+	// evaluate the final model on the test set if requested
+	if job.task.Parameters.Options.FinalEvaluation && job.exitErr == nil {
+		err = job.evaluate()
+		if err != nil {
+			job.logger.Error("error performing final evaluation",
+				zap.Error(err))
+		}
+	}
 
 	job.logger.Info("Exiting...", zap.Any("history", job.history))
 	job.logger.Info(fmt.Sprintf("Training finished after %d epochs", job.epoch-1))
@@ -279,8 +431,16 @@ func (job *TrainJob) init() error {
 	job.logger.Debug("Received layers", zap.Any("layers", layers))
 	job.logger.Debug("Creating model")
 	m := model.NewModel(job.logger, job.jobId, job.task.Parameters, layers, job.redisPool)
+	m.SetDeterministic(job.task.Parameters.Options.Seed != nil)
 	job.model = m
 
+	// count the documents to split them among the functions, if
+	// it fails the functions choose their documents from their id
+	job.numDocs, err = job.countDocuments()
+	if err != nil {
+		job.logger.Warn("Could not count the documents of the dataset", zap.Error(err))
+	}
+
 	err = m.Build()
 	if err != nil {
 		return errors.Wrap(err, "error building model")
@@ -294,37 +454,59 @@ func (job *TrainJob) init() error {
 // returns the total time that the model spent training
 func (job *TrainJob) train() error {
 	job.logger.Info("Started new epoch", zap.Int("epoch", job.epoch))
+	job.transition(api.PhaseTraining)
+	job.recordEvent(api.EventEpochStart, "", map[string]interface{}{
+		"parallelism": job.parallelism,
+		"k":           job.K,
+		"batch_size":  job.batchSize,
+		"lr":          job.lr,
+	})
 
-	// set the channels and wait groups for the
-	// K-AVG model merger to receive models from the
-	// functions every K local forward passes
-	job.finishCh = make(chan *finishNotification, job.parallelism)
-	job.wgIteration.Add(job.parallelism)
-	atomic.StoreInt64(&job.finishedFuncs, 0)
-	errChan := make(chan error, 1)
-	job.startMerger <- errChan
+	job.records = nil
+	job.divergence, job.divergenceRounds = 0, 0
 
 	start := time.Now()
-	loss, _, err := job.invokeTrainFunctions()
+	shards := job.epochShards()
+	results, err := job.trainRound(shards, false)
 	if err != nil {
-		return errors.Wrap(err, "error invoking functions")
+		return err
 	}
 
-	// check if there was an error merging the model
-	select {
-	case err := <-errChan:
-		return errors.Wrap(err, "error merging model")
-	default:
+	// train again the shards of the functions that failed, once
+	// the model of the first round is merged
+	failed := failedShards(shards, results)
+	if len(failed) > 0 && job.numDocs > 0 {
+		job.logger.Warn("Retraining the shards of the failed functions",
+			zap.Int("functions", len(failed)))
+		<-job.merged
+
+		recovered, err := job.trainRound(failed, true)
+		if err != nil {
+			return err
+		}
+		failed = failedShards(failed, recovered)
+		results = append(results, recovered...)
 	}
 
+	loss, _ := getAverageLoss(results)
+	metrics := aggregateMetrics(results, job.task.Parameters.Options.MetricAggregation)
+	coverage := job.coverage(failed, len(results))
+
 	// update the elapsed time
 	elapsed := time.Since(start)
 	job.task.Job.State.ElapsedTime = elapsed.Seconds()
+	job.task.Job.State.Loss = loss
 
 	job.logger.Info("Epoch finished")
+	job.recordEvent(api.EventEpochEnd, "", map[string]interface{}{
+		"loss":     loss,
+		"coverage": coverage,
+		"duration": elapsed.Seconds(),
+	})
 
 	// update the training metrics
-	err = job.updateTrainMetrics(loss, time.Since(job.startTime))
+	err = job.updateTrainMetrics(loss, metrics, coverage, time.Since(job.startTime), job.functionRecords())
+	job.saveHistory(api.StatusRunning)
 	if err != nil {
 		job.logger.Error("error updating metrics", zap.Error(err))
 	}
@@ -333,17 +515,110 @@ func (job *TrainJob) train() error {
 	return nil
 }
 
+// trainRound invokes a train function for each of the shards and starts
+// the K-AVG model merger, which receives the models from the functions
+// every K local forward passes. It returns the results of the functions. The
+// recovery rounds do not fail if the functions fail, since their shards are
+// then just reported as not covered
+func (job *TrainJob) trainRound(shards [][]api.Shard, recovery bool) ([]*FunctionResults, error) {
+	n := len(shards)
+	job.roundShards = shards
+	job.roundFuncs = n
+	job.recovery = recovery
+
+	// set the channels and wait groups for the merger
+	job.finishCh = make(chan *finishNotification, n)
+	job.wgIteration.Add(n)
+	atomic.StoreInt64(&job.finishedFuncs, 0)
+	job.syncs = make([]int64, n)
+	errChan := make(chan error, 1)
+	job.startMerger <- errChan
+
+	results, err := job.invokeTrainFunctions(shards)
+	if err != nil {
+		if !recovery {
+			return nil, errors.Wrap(err, "error invoking functions")
+		}
+		job.logger.Error("error retraining shards", zap.Error(err))
+	}
+
+	// check if there was an error merging the model
+	select {
+	case err := <-errChan:
+		return nil, errors.Wrap(err, "error merging model")
+	default:
+	}
+
+	return results, nil
+}
+
 // validate invokes the validation functions
-// it uses the same degree of parallelism as the train functions and
-// averages the results from the functions later
-func (job *TrainJob) validate() error {
+// it uses the validation parallelism, or the one of the train functions,
+// and averages the results from the functions later. Unless full is set
+// the functions only validate on the configured fraction of the test set
+func (job *TrainJob) validate(full bool) error {
+	job.transition(api.PhaseValidating)
+	return job.runValidation(job.validationArgs(full))
+}
+
+// validationArgs returns the parallelism and the fraction of the test set
+// of the next validation
+func (job *TrainJob) validationArgs(full bool) validationArgs {
+	v := validationArgs{parallelism: job.parallelism, fraction: job.valFraction}
+	if job.valParallelism > 0 {
+		v.parallelism = job.valParallelism
+	}
+	if full {
+		v.fraction = 0
+	}
+	return v
+}
+
+// validateRound validates the model merged in a round while the functions
+// keep training. It is skipped if the last one is still running
+func (job *TrainJob) validateRound(round int) {
+	if !atomic.CompareAndSwapInt32(&job.roundValidating, 0, 1) {
+		job.logger.Debug("Validation still running, skipping round", zap.Int("round", round))
+		return
+	}
+
+	v := job.validationArgs(false)
+	job.wgValidation.Add(1)
+	go func() {
+		defer job.wgValidation.Done()
+		defer atomic.StoreInt32(&job.roundValidating, 0)
+
+		if err := job.runValidation(v); err != nil {
+			job.logger.Error("error performing round validation",
+				zap.Int("round", round),
+				zap.Error(err))
+		}
+	}()
+}
+
+// runValidation invokes the validation functions, saves their results
+// in the history and notifies if the goal accuracy is reached
+func (job *TrainJob) runValidation(v validationArgs) error {
+	job.valMu.Lock()
+	defer job.valMu.Unlock()
+
+	// every validation samples a different part of the test set
+	job.validations++
+	v.sample = job.validations
+
 	// invoke the validation function concurrently
-	accuracy, loss, err := job.invokeValFunctions()
+	accuracy, loss, metrics, err := job.invokeValFunctions(v)
 	if err != nil {
 		return errors.Wrap(err, "error during validation")
 	}
 
-	err = job.updateValidationMetrics(loss, accuracy)
+	job.recordEvent(api.EventValidation, "", map[string]interface{}{
+		"accuracy": accuracy,
+		"loss":     loss,
+	})
+
+	err = job.updateValidationMetrics(loss, accuracy, metrics)
+	job.saveHistory(api.StatusRunning)
 	if err != nil {
 		return errors.Wrap(err, "error sending val results")
 	}
@@ -355,7 +630,10 @@ func (job *TrainJob) validate() error {
 		job.logger.Debug("goal accuracy reached, sending message",
 			zap.Float64("goal", job.goalAccuracy),
 			zap.Float64("acc", accuracy))
-		job.accuracyCh <- struct{}{}
+		select {
+		case job.accuracyCh <- struct{}{}:
+		default:
+		}
 	}
 
 	return nil
@@ -370,7 +648,7 @@ func (job *TrainJob) mergeModel() {
 	for {
 		errChan := <-job.startMerger
 
-		for {
+		for round := 1; ; round++ {
 			job.model.Clear()
 			job.logger.Debug("Waiting for functions to finish...")
 			job.wgIteration.Wait()
@@ -379,10 +657,14 @@ func (job *TrainJob) mergeModel() {
 			// when fetching and merging the model
 			var funcs []int
 			var channels []chan MergeResult
+			var loss float64
+			var samples int
 			close(job.finishCh)
 			for msg := range job.finishCh {
 				funcs = append(funcs, msg.funcId)
 				channels = append(channels, msg.respChan)
+				loss += msg.loss * float64(msg.samples)
+				samples += msg.samples
 			}
 
 			if len(funcs) == 0 {
@@ -401,6 +683,8 @@ func (job *TrainJob) mergeModel() {
 				errChan <- err
 				break
 			}
+			job.divergence += job.model.Divergence(len(funcs))
+			job.divergenceRounds++
 
 			err = job.model.Save()
 			if err != nil {
@@ -411,10 +695,27 @@ func (job *TrainJob) mergeModel() {
 			}
 			job.logger.Debug("Merge and save took", zap.Float64("time", time.Since(mergeStart).Seconds()))
 
+			details := map[string]interface{}{
+				"round":     round,
+				"functions": len(funcs),
+				"duration":  time.Since(mergeStart).Seconds(),
+			}
+			if samples > 0 {
+				details["loss"] = loss / float64(samples)
+			}
+			job.recordEvent(api.EventMerge, "", details)
+			job.mergeRounds++
+
+			// save the loss of the round if the functions reported it, before
+			// the last round of the epoch lets the job move to the next epoch
+			if samples > 0 {
+				job.updateIterationMetrics(round, loss/float64(samples), samples)
+			}
+
 			finished := atomic.LoadInt64(&job.finishedFuncs)
 			job.logger.Debug("finished funcs are", zap.Int64("num", finished))
 			// initialize the wait group again by checking the number of finished functions
-			remaining := job.parallelism - int(finished)
+			remaining := job.roundFuncs - int(finished)
 			if remaining == 0 {
 				job.logger.Debug("all functions finished, quiting...")
 
@@ -435,6 +736,12 @@ func (job *TrainJob) mergeModel() {
 				// it might be that some functions have to do 1 more iteration,
 				// so those send a nil channel
 				answerFunctions(MergeSucceeded, channels)
+
+				// validate the merged model if configured, the
+				// last round of the epoch is followed by the epoch validation
+				if job.validateEveryRounds > 0 && job.mergeRounds%job.validateEveryRounds == 0 {
+					job.validateRound(job.mergeRounds)
+				}
 			}
 		}
 	}
@@ -0,0 +1,174 @@
+package train
+
+import (
+	"context"
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// shardBlocks is the number of blocks per function in which the
+// documents are split when shuffling the shards
+const shardBlocks = 8
+
+// countDocuments returns the number of documents of the train set of the
+// dataset. In cross validation runs the documents of the fold held out
+// for validation are not counted, since the functions skip them
+func (job *TrainJob) countDocuments() (int, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(createMongoURI()))
+	if err != nil {
+		return 0, errors.Wrap(err, "could not create mongo client")
+	}
+
+	err = client.Connect(context.TODO())
+	if err != nil {
+		return 0, errors.Wrap(err, "could not connect to mongo")
+	}
+	defer client.Disconnect(context.TODO())
+
+	collection := client.Database(job.task.Parameters.Dataset).Collection("train")
+	count, err := collection.CountDocuments(context.TODO(), bson.M{})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not count documents")
+	}
+
+	total := int(count)
+	if opts := job.task.Parameters.Options; opts.Folds > 1 {
+		fold := splitRange(total, opts.Folds)[opts.Fold]
+		total -= fold.End - fold.Start
+	}
+
+	return total, nil
+}
+
+// epochShards returns the shards of each of the functions of the epoch. The
+// documents are split in contiguous ranges or, if the shards are shuffled, in
+// blocks that are randomly distributed among the functions. There are never
+// more functions than documents, so every function gets a non-empty shard
+func (job *TrainJob) epochShards() [][]api.Shard {
+	if job.numDocs == 0 {
+		return make([][]api.Shard, job.parallelism)
+	}
+
+	n := min(job.parallelism, job.numDocs)
+	shards := make([][]api.Shard, n)
+
+	if !job.task.Parameters.Options.ShuffleShards {
+		for i, r := range splitRange(job.numDocs, n) {
+			shards[i] = []api.Shard{r}
+		}
+		return shards
+	}
+
+	numBlocks := n * shardBlocks
+	if numBlocks > job.numDocs {
+		numBlocks = job.numDocs
+	}
+	blocks := splitRange(job.numDocs, numBlocks)
+
+	rng := job.shardRand()
+	rng.Shuffle(len(blocks), func(i, j int) {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	})
+
+	for i, r := range splitRange(len(blocks), n) {
+		shards[i] = mergeShards(blocks[r.Start:r.End])
+	}
+	return shards
+}
+
+// shardRand returns the generator used to shuffle the shards of the
+// epoch, which is seeded from the seed of the job if it is set
+func (job *TrainJob) shardRand() *rand.Rand {
+	if seed := job.task.Parameters.Options.Seed; seed != nil {
+		return rand.New(rand.NewSource(*seed + int64(job.epoch)))
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// coverage returns the fraction of the documents of the epoch that
+// were trained on, given the shards left unfinished. If the documents
+// are unknown it is the fraction of the functions that succeeded
+func (job *TrainJob) coverage(failed [][]api.Shard, results int) float64 {
+	if job.numDocs == 0 {
+		if job.parallelism == 0 {
+			return 0
+		}
+		return float64(results) / float64(job.parallelism)
+	}
+
+	missing := 0
+	for _, shards := range failed {
+		for _, s := range shards {
+			missing += s.End - s.Start
+		}
+	}
+	return 1 - float64(missing)/float64(job.numDocs)
+}
+
+// failedShards returns the shards of the functions that did not return a result
+func failedShards(shards [][]api.Shard, results []*FunctionResults) [][]api.Shard {
+	finished := make(map[int]bool, len(results))
+	for _, res := range results {
+		finished[res.funcId] = true
+	}
+
+	var failed [][]api.Shard
+	for funcId, s := range shards {
+		if !finished[funcId] && len(s) > 0 {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// splitRange splits the range from 0 to total in n contiguous
+// ranges whose lengths differ at most by one
+func splitRange(total, n int) []api.Shard {
+	k, m := total/n, total%n
+
+	ranges := make([]api.Shard, n)
+	for i := range ranges {
+		ranges[i] = api.Shard{
+			Start: i*k + min(i, m),
+			End:   (i+1)*k + min(i+1, m),
+		}
+	}
+	return ranges
+}
+
+// mergeShards joins the consecutive shards that are contiguous
+func mergeShards(shards []api.Shard) []api.Shard {
+	var merged []api.Shard
+	for _, s := range shards {
+		if n := len(merged); n > 0 && merged[n-1].End == s.Start {
+			merged[n-1].End = s.End
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// formatShards encodes the shards as the list of ranges start:end
+// separated by commas that is sent to the functions
+func formatShards(shards []api.Shard) string {
+	ranges := make([]string, len(shards))
+	for i, s := range shards {
+		ranges[i] = fmt.Sprintf("%d:%d", s.Start, s.End)
+	}
+	return strings.Join(ranges, ",")
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,168 @@
+package train
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"reflect"
+	"testing"
+)
+
+func shard(start, end int) api.Shard {
+	return api.Shard{Start: start, End: end}
+}
+
+func TestSplitRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int
+		n     int
+		want  []api.Shard
+	}{
+		{name: "even", total: 6, n: 3, want: []api.Shard{shard(0, 2), shard(2, 4), shard(4, 6)}},
+		{name: "remainder", total: 7, n: 3, want: []api.Shard{shard(0, 3), shard(3, 5), shard(5, 7)}},
+		{name: "single", total: 5, n: 1, want: []api.Shard{shard(0, 5)}},
+		{name: "total smaller than n", total: 2, n: 3, want: []api.Shard{shard(0, 1), shard(1, 2), shard(2, 2)}},
+		{name: "empty", total: 0, n: 2, want: []api.Shard{shard(0, 0), shard(0, 0)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitRange(tt.total, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeShards(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards []api.Shard
+		want   []api.Shard
+	}{
+		{name: "empty", shards: nil, want: nil},
+		{name: "contiguous", shards: []api.Shard{shard(0, 2), shard(2, 4), shard(4, 5)}, want: []api.Shard{shard(0, 5)}},
+		{name: "gaps", shards: []api.Shard{shard(0, 2), shard(4, 6), shard(6, 8)}, want: []api.Shard{shard(0, 2), shard(4, 8)}},
+		{name: "unordered", shards: []api.Shard{shard(4, 6), shard(0, 2), shard(2, 4)}, want: []api.Shard{shard(4, 6), shard(0, 4)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeShards(tt.shards); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailedShards(t *testing.T) {
+	shards := [][]api.Shard{{shard(0, 2)}, {shard(2, 4)}, {}, {shard(4, 6), shard(8, 9)}}
+
+	tests := []struct {
+		name     string
+		finished []int
+		want     [][]api.Shard
+	}{
+		{name: "all finished", finished: []int{0, 1, 2, 3}, want: nil},
+		{name: "some failed", finished: []int{1}, want: [][]api.Shard{{shard(0, 2)}, {shard(4, 6), shard(8, 9)}}},
+		{name: "empty shards are not failed", finished: []int{0, 1, 3}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []*FunctionResults
+			for _, id := range tt.finished {
+				results = append(results, &FunctionResults{funcId: id})
+			}
+			if got := failedShards(shards, results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	tests := []struct {
+		name        string
+		numDocs     int
+		parallelism int
+		failed      [][]api.Shard
+		results     int
+		want        float64
+	}{
+		{name: "nothing failed", numDocs: 10, parallelism: 2, results: 2, want: 1},
+		{name: "documents missing", numDocs: 10, parallelism: 2, failed: [][]api.Shard{{shard(0, 2), shard(5, 7)}}, results: 1, want: 0.6},
+		{name: "unknown documents", parallelism: 4, results: 3, want: 0.75},
+		{name: "no functions", results: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &TrainJob{numDocs: tt.numDocs, parallelism: tt.parallelism}
+			if got := job.coverage(tt.failed, tt.results); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEpochShards(t *testing.T) {
+	seed := int64(1)
+
+	tests := []struct {
+		name        string
+		numDocs     int
+		parallelism int
+		shuffle     bool
+		functions   int
+	}{
+		{name: "contiguous", numDocs: 100, parallelism: 4, functions: 4},
+		{name: "shuffled", numDocs: 100, parallelism: 4, shuffle: true, functions: 4},
+		{name: "fewer documents than functions", numDocs: 3, parallelism: 5, functions: 3},
+		{name: "shuffled fewer documents than blocks", numDocs: 10, parallelism: 4, shuffle: true, functions: 4},
+		{name: "unknown documents", numDocs: 0, parallelism: 3, functions: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &TrainJob{
+				numDocs:     tt.numDocs,
+				parallelism: tt.parallelism,
+				task: &api.TrainTask{Parameters: api.TrainRequest{
+					Options: api.TrainOptions{ShuffleShards: tt.shuffle, Seed: &seed},
+				}},
+			}
+
+			shards := job.epochShards()
+			if len(shards) != tt.functions {
+				t.Fatalf("got %v functions, want %v", len(shards), tt.functions)
+			}
+			if tt.numDocs == 0 {
+				return
+			}
+
+			// every document is in exactly one shard and no shard is empty
+			seen := make([]bool, tt.numDocs)
+			for i, fs := range shards {
+				if len(fs) == 0 {
+					t.Errorf("function %v got no shards", i)
+				}
+				for _, s := range fs {
+					if s.Start >= s.End {
+						t.Errorf("function %v got the empty shard %v", i, s)
+					}
+					for d := s.Start; d < s.End; d++ {
+						if seen[d] {
+							t.Errorf("document %v is in more than one shard", d)
+						}
+						seen[d] = true
+					}
+				}
+			}
+			for d, ok := range seen {
+				if !ok {
+					t.Errorf("document %v is not in any shard", d)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package train
+
+import (
+	"fmt"
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"github.com/diegostock12/kubeml/ml/pkg/util"
+	"go.uber.org/zap"
+	"time"
+)
+
+// transitions holds the phases a job can move to from each of the phases
+// of its lifecycle. Terminal phases do not appear since the job cannot leave them,
+// and once stopping the job can only end up stopped
+var transitions = map[api.JobPhase][]api.JobPhase{
+	api.PhasePending:      {api.PhaseInitializing},
+	api.PhaseInitializing: {api.PhaseTraining, api.PhaseStopping, api.PhaseFailed},
+	api.PhaseTraining:     {api.PhaseMerging, api.PhaseStopping, api.PhaseFailed},
+	api.PhaseMerging:      {api.PhaseTraining, api.PhaseValidating, api.PhasePaused, api.PhaseSucceeded, api.PhaseStopping, api.PhaseFailed},
+	api.PhaseValidating:   {api.PhaseTraining, api.PhasePaused, api.PhaseSucceeded, api.PhaseStopping, api.PhaseFailed},
+	api.PhasePaused:       {api.PhaseTraining, api.PhaseStopping},
+	api.PhaseStopping:     {api.PhaseStopped},
+}
+
+// canTransition returns true if the job can move from one phase to the other
+func canTransition(from, to api.JobPhase) bool {
+	for _, phase := range transitions[from] {
+		if phase == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition moves the job to the given phase in the current epoch. It is
+// called from the training loop, and invalid transitions (i.e. when
+// the job is already stopping) are ignored and returned as an error
+func (job *TrainJob) transition(phase api.JobPhase) error {
+	return job.setPhase(phase, job.cappedEpoch())
+}
+
+// setEpoch moves the training loop to the given epoch. The epoch is
+// only written by the training loop, which can read it without the lock
+func (job *TrainJob) setEpoch(epoch int) {
+	job.stateMu.Lock()
+	job.epoch = epoch
+	job.stateMu.Unlock()
+}
+
+// currentEpoch returns the epoch of the training loop, it is
+// used by the api handlers and the validation goroutines
+func (job *TrainJob) currentEpoch() int {
+	job.stateMu.Lock()
+	defer job.stateMu.Unlock()
+	return job.epoch
+}
+
+// cappedEpoch returns the current epoch of the job. Once the training
+// loop is over the epoch counter goes past the last epoch, so it is capped
+func (job *TrainJob) cappedEpoch() int {
+	epoch := job.currentEpoch()
+	if job.task != nil && epoch > job.task.Parameters.Epochs {
+		epoch = job.task.Parameters.Epochs
+	}
+	return epoch
+}
+
+// requestStop moves the job to the stopping phase keeping the epoch
+// it is at. It returns an error if the job cannot be stopped
+func (job *TrainJob) requestStop() error {
+	job.stateMu.Lock()
+	epoch := job.phaseEpoch
+	job.stateMu.Unlock()
+
+	return job.setPhase(api.PhaseStopping, epoch)
+}
+
+// requestPause marks the job to be paused once the current epoch is finished
+func (job *TrainJob) requestPause() error {
+	job.stateMu.Lock()
+	defer job.stateMu.Unlock()
+
+	switch job.phase {
+	case api.PhaseInitializing, api.PhaseTraining, api.PhaseMerging, api.PhaseValidating:
+		job.pauseRequested = true
+		return nil
+	default:
+		return fmt.Errorf("job cannot be paused while %v", job.phase)
+	}
+}
+
+// requestResume wakes up a paused job, or cancels the pause
+// if the job did not get to pause yet
+func (job *TrainJob) requestResume() error {
+	job.stateMu.Lock()
+	defer job.stateMu.Unlock()
+
+	switch {
+	case job.phase == api.PhasePaused:
+		select {
+		case job.resumeCh <- struct{}{}:
+		default:
+		}
+		return nil
+	case job.pauseRequested:
+		job.pauseRequested = false
+		return nil
+	default:
+		return fmt.Errorf("job is not paused")
+	}
+}
+
+// pauseIfRequested blocks the training loop between epochs while the
+// job is paused. The reference model stays in the tensor store, and the
+// scheduler is notified so it releases the resources of the job.
+//
+// It returns false if the job was stopped while paused
+func (job *TrainJob) pauseIfRequested() bool {
+	job.stateMu.Lock()
+	requested := job.pauseRequested
+	job.pauseRequested = false
+	job.stateMu.Unlock()
+
+	if !requested {
+		return true
+	}
+
+	// discard resume signals from previous pauses
+	select {
+	case <-job.resumeCh:
+	default:
+	}
+
+	if err := job.transition(api.PhasePaused); err != nil {
+		return true
+	}
+
+	job.logger.Info("Job paused", zap.Int("epoch", job.epoch))
+	if err := job.scheduler.PauseJob(job.jobId); err != nil {
+		job.logger.Error("error sending pause to the scheduler", zap.Error(err))
+	}
+
+	// the scheduler may not have the functions to resume the job
+	// right away, in that case it resumes the job once it has them
+	for {
+		select {
+		case <-job.resumeCh:
+			if !job.acquireFunctions() {
+				job.logger.Info("Not enough functions to resume, waiting for the scheduler")
+				continue
+			}
+			job.logger.Info("Job resumed",
+				zap.Int("epoch", job.epoch),
+				zap.Int("parallelism", job.parallelism))
+			return true
+		case <-job.stopChan:
+			return false
+		}
+	}
+}
+
+// acquireFunctions asks the scheduler for the functions to resume the job and
+// applies the parallelism given, returning false if the job has to wait
+func (job *TrainJob) acquireFunctions() bool {
+	task := *job.task
+	task.Job.State.Parallelism = job.parallelism
+
+	parallelism, err := job.scheduler.ResumeJob(&task)
+	if err != nil {
+		job.logger.Error("error sending resume to the scheduler", zap.Error(err))
+		return true
+	}
+	if parallelism == 0 {
+		return false
+	}
+
+	job.task.Job.State.Parallelism = parallelism
+	if parallelism != job.parallelism && !util.IsDebugEnv() && !util.LimitParallelism() {
+		job.parallelism = parallelism
+		job.rescaleHyperparameters()
+	}
+	return true
+}
+
+// finish moves the job to its terminal phase depending on
+// how the training process ended
+func (job *TrainJob) finish() {
+	switch {
+	case job.currentPhase() == api.PhaseStopping:
+		job.transition(api.PhaseStopped)
+	case job.exitErr != nil:
+		job.transition(api.PhaseFailed)
+	default:
+		job.transition(api.PhaseSucceeded)
+	}
+}
+
+// currentPhase returns the phase the job is in
+func (job *TrainJob) currentPhase() api.JobPhase {
+	job.stateMu.Lock()
+	defer job.stateMu.Unlock()
+	return job.phase
+}
+
+// setPhase performs the transition and reports the new state
+// of the job to the parameter server
+func (job *TrainJob) setPhase(phase api.JobPhase, epoch int) error {
+	job.stateMu.Lock()
+	if !canTransition(job.phase, phase) {
+		current := job.phase
+		job.stateMu.Unlock()
+		job.logger.Debug("Ignoring invalid transition",
+			zap.String("from", string(current)),
+			zap.String("to", string(phase)))
+		return fmt.Errorf("job cannot go from %v to %v", current, phase)
+	}
+
+	job.phase = phase
+	job.phaseEpoch = epoch
+	job.lastTransition = time.Now()
+	state := api.JobState{
+		Phase:          job.phase,
+		Epoch:          job.phaseEpoch,
+		LastTransition: job.lastTransition,
+	}
+	job.stateMu.Unlock()
+
+	job.logger.Debug("Job changed phase",
+		zap.String("phase", string(phase)),
+		zap.Int("epoch", epoch))
+
+	if err := job.ps.UpdateState(job.jobId, &state); err != nil {
+		job.logger.Error("error sending state to the ps", zap.Error(err))
+	}
+
+	return nil
+}
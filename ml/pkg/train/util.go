@@ -8,21 +8,37 @@ import (
 	"github.com/diegostock12/kubeml/ml/pkg/util"
 	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"sync/atomic"
 	"time"
 )
 
+// reservedMetrics are the results of the functions that have their own
+// fields in the history and are not treated as custom metrics
+var reservedMetrics = map[string]struct{}{
+	"loss":     {},
+	"accuracy": {},
+	"length":   {},
+}
+
 // updateValidationMetrics updates the validation statistics in the PS
-func (job *TrainJob) updateValidationMetrics(valLoss, accuracy float64) error {
+func (job *TrainJob) updateValidationMetrics(valLoss, accuracy float64, metrics map[string]float64) error {
+	job.historyMu.Lock()
 	job.history.ValidationLoss = append(job.history.ValidationLoss, valLoss)
 	job.history.Accuracy = append(job.history.Accuracy, accuracy)
+	job.history.ValidationEpochs = append(job.history.ValidationEpochs, job.cappedEpoch())
+	job.history.ValidationMetrics = appendMetrics(job.history.ValidationMetrics, metrics)
+	update := getLatestMetrics(&job.history)
+	job.historyMu.Unlock()
 
 	// send the update to the PS
-	err := job.ps.UpdateMetrics(job.jobId, getLatestMetrics(&job.history))
+	err := job.ps.UpdateMetrics(job.jobId, update)
 	if err != nil {
 		return errors.Wrap(err, "error sending validation update to parameter server")
 	}
@@ -33,15 +49,29 @@ func (job *TrainJob) updateValidationMetrics(valLoss, accuracy float64) error {
 
 // updateTrainMetrics updates the metrics in the job history and sends an update to the
 // parameter server to publish the new metrics to prometheus
-func (job *TrainJob) updateTrainMetrics(loss float64, elapsed time.Duration) error {
+func (job *TrainJob) updateTrainMetrics(
+	loss float64,
+	metrics map[string]float64,
+	coverage float64,
+	elapsed time.Duration,
+	records []api.FunctionRecord) error {
 
 	// add the new metrics to the history
+	job.historyMu.Lock()
 	job.history.Parallelism = append(job.history.Parallelism, float64(job.parallelism))
 	job.history.EpochDuration = append(job.history.EpochDuration, elapsed.Seconds())
 	job.history.TrainLoss = append(job.history.TrainLoss, loss)
+	job.history.Coverage = append(job.history.Coverage, coverage)
+	job.history.K = append(job.history.K, float64(job.K))
+	job.history.BatchSize = append(job.history.BatchSize, float64(job.batchSize))
+	job.history.LearningRate = append(job.history.LearningRate, float64(job.lr))
+	job.history.Functions = append(job.history.Functions, records...)
+	job.history.TrainMetrics = appendMetrics(job.history.TrainMetrics, metrics)
+	update := getLatestMetrics(&job.history)
+	job.historyMu.Unlock()
 
 	// send the update to the PS
-	err := job.ps.UpdateMetrics(job.jobId, getLatestMetrics(&job.history))
+	err := job.ps.UpdateMetrics(job.jobId, update)
 	if err != nil {
 		return errors.Wrap(err, "error sending train update to parameter server")
 	}
@@ -49,6 +79,42 @@ func (job *TrainJob) updateTrainMetrics(loss float64, elapsed time.Duration) err
 	return nil
 }
 
+// updateIterationMetrics saves the loss of a merge round in the history and
+// sends it to the parameter server in the background, so the merger does not
+// wait for the request. The update is skipped if the last one is still being
+// sent, the next round or the end of the epoch sends the latest loss
+func (job *TrainJob) updateIterationMetrics(round int, loss float64, samples int) {
+	job.historyMu.Lock()
+	job.history.IterationLoss = append(job.history.IterationLoss, api.IterationMetric{
+		Epoch:   job.epoch,
+		Round:   round,
+		Loss:    loss,
+		Samples: samples,
+	})
+	job.historyMu.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&job.publishingIteration, 0, 1) {
+		job.logger.Debug("Iteration update still being sent, skipping round", zap.Int("round", round))
+		return
+	}
+
+	job.wgMetrics.Add(1)
+	go func() {
+		defer job.wgMetrics.Done()
+		defer atomic.StoreInt32(&job.publishingIteration, 0)
+
+		job.historyMu.RLock()
+		update := getLatestMetrics(&job.history)
+		job.historyMu.RUnlock()
+
+		if err := job.ps.UpdateMetrics(job.jobId, update); err != nil {
+			job.logger.Error("error sending iteration update to parameter server",
+				zap.Int("round", round),
+				zap.Error(err))
+		}
+	}()
+}
+
 func createMongoURI() string {
 	if util.IsDebugEnv() {
 		return api.MongoUrlDebug
@@ -77,15 +143,33 @@ func parseLayerNames(resp *http.Response) ([]string, error) {
 
 }
 
+// collectResults closes the response channel of the functions
+// and returns all the results received
+func collectResults(respChan chan *FunctionResults) []*FunctionResults {
+	var results []*FunctionResults
+
+	// close the channel so it can be iterated over
+	close(respChan)
+	for response := range respChan {
+		results = append(results, response)
+	}
+
+	// sort them so the metrics are aggregated
+	// in the same order every time
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].funcId < results[j].funcId
+	})
+
+	return results
+}
+
 // getAverageLoss iterates through the function results gotten from several
 // training functions and returns the average loss and the ids of the functions that completed
-func getAverageLoss(respChan chan *FunctionResults) (float64, []int) {
+func getAverageLoss(results []*FunctionResults) (float64, []int) {
 	var funcs []int
 	var loss float64
 
-	// close the channel so it can be iterated over
-	close(respChan)
-	for response := range respChan {
+	for _, response := range results {
 		loss += response.results["loss"]
 		funcs = append(funcs, response.funcId)
 	}
@@ -97,16 +181,13 @@ func getAverageLoss(respChan chan *FunctionResults) (float64, []int) {
 // getValidationMetrics analyzes the results of validation functions containing
 // the accuracy, the loss and the number of datapoints used in each, and performs
 // the weighted averaging of both according to the number of points
-func getValidationMetrics(respChan chan *FunctionResults) (float64, float64, float64) {
+func getValidationMetrics(results []*FunctionResults) (float64, float64, float64) {
 	var accuracy float64
 	var loss float64
 	var total float64
 
-	// close the channel
-	close(respChan)
-
 	// the json has atributes loss, accuracy and length
-	for response := range respChan {
+	for _, response := range results {
 		length := response.results["length"]
 		loss += response.results["loss"] * length
 		accuracy += response.results["accuracy"] * length
@@ -121,6 +202,82 @@ func getValidationMetrics(respChan chan *FunctionResults) (float64, float64, flo
 
 }
 
+// aggregateMetrics merges the custom metrics returned by the functions
+// following the aggregation rule set for each of them. Each function returns a
+// flat map of metric names to numbers, along with the reserved loss, accuracy
+// and length, the number of samples it used. The mean rule averages the values
+// of the functions, and metrics without a rule are averaged weighting the
+// value of each function by its length
+func aggregateMetrics(results []*FunctionResults, rules map[string]string) map[string]float64 {
+	metrics := make(map[string]float64)
+	weights := make(map[string]float64)
+
+	for _, response := range results {
+		length, exists := response.results["length"]
+		if !exists || length <= 0 {
+			length = 1
+		}
+
+		for name, value := range response.results {
+			if _, reserved := reservedMetrics[name]; reserved {
+				continue
+			}
+
+			switch rules[name] {
+			case api.AggregationMean:
+				metrics[name] += value
+				weights[name]++
+			case api.AggregationSum:
+				metrics[name] += value
+			case api.AggregationMax:
+				if current, exists := metrics[name]; !exists || value > current {
+					metrics[name] = value
+				}
+			default:
+				metrics[name] += value * length
+				weights[name] += length
+			}
+		}
+	}
+
+	for name, weight := range weights {
+		metrics[name] /= weight
+	}
+
+	return metrics
+}
+
+// appendMetrics adds the latest values of the custom metrics
+// to their series in the history
+func appendMetrics(series map[string][]float64, metrics map[string]float64) map[string][]float64 {
+	if len(metrics) == 0 {
+		return series
+	}
+
+	if series == nil {
+		series = make(map[string][]float64)
+	}
+	for name, value := range metrics {
+		series[name] = append(series[name], value)
+	}
+
+	return series
+}
+
+// latestMetrics returns the last value of each of the custom metric series
+func latestMetrics(series map[string][]float64) map[string]float64 {
+	if len(series) == 0 {
+		return nil
+	}
+
+	metrics := make(map[string]float64, len(series))
+	for name, values := range series {
+		metrics[name] = lastValue(values)
+	}
+
+	return metrics
+}
+
 // parseFunctionResults takes care of extracting the results from the response body
 func parseFunctionResults(resp *http.Response) (map[string]float64, error) {
 
@@ -154,9 +311,9 @@ func (job *TrainJob) checkFunctionErrors(respChan chan *FunctionResults, errChan
 			return errors.New("all functions returned an unknown error")
 		}
 
-	case num < job.parallelism:
+	case num < cap(respChan):
 		job.logger.Warn("Some of the functions returned without a result",
-			zap.Int("parallelism", job.parallelism),
+			zap.Int("functions", cap(respChan)),
 			zap.Int("responses", num))
 		return nil
 
@@ -196,13 +353,22 @@ func lastValue(arr []float64) float64 {
 // object that will be sent to the parameter server api to update the counters
 // of the job
 func getLatestMetrics(history *api.JobHistory) *api.MetricUpdate {
-	return &api.MetricUpdate{
+	update := &api.MetricUpdate{
 		ValidationLoss: lastValue(history.ValidationLoss),
 		Accuracy:       lastValue(history.Accuracy),
 		TrainLoss:      lastValue(history.TrainLoss),
 		Parallelism:    lastValue(history.Parallelism),
 		EpochDuration:  lastValue(history.EpochDuration),
+
+		TrainMetrics:      latestMetrics(history.TrainMetrics),
+		ValidationMetrics: latestMetrics(history.ValidationMetrics),
+	}
+
+	if n := len(history.IterationLoss); n > 0 {
+		update.IterationLoss = history.IterationLoss[n-1].Loss
 	}
+
+	return update
 }
 
 // clearTensors simply drops the keys and values used during training by the
@@ -243,38 +409,90 @@ func (job *TrainJob) clearTensors() {
 	job.logger.Debug("Delete from the database", zap.Int("num tensors", num))
 }
 
-// saveTrainingHistory saves the history in the mongo database
-func (job *TrainJob) saveTrainingHistory() {
-	// get the mongo connection
-	client, err := mongo.NewClient(options.Client().ApplyURI(createMongoURI()))
+// saveHistory upserts the history in the mongo database with the given status.
+// It is saved after every epoch and validation so the progress of the
+// job can be checked during the training and is kept if the job crashes
+func (job *TrainJob) saveHistory(status string) {
+	client, err := job.historyClient()
 	if err != nil {
-		job.logger.Error("Could not create mongo client", zap.Error(err))
+		job.logger.Error("Could not connect to mongo", zap.Error(err))
 		return
 	}
 
 	// Save the history in the kubeml database in the history collections
-	err = client.Connect(context.TODO())
+	collection := client.Database("kubeml").Collection("history")
+
+	job.historyMu.RLock()
+	defer job.historyMu.RUnlock()
+
+	h := api.History{
+		Id:     job.jobId,
+		Task:   job.task.Parameters,
+		Data:   job.history,
+		Status: status,
+		Report: job.report,
+	}
+
+	_, err = collection.ReplaceOne(context.TODO(),
+		bson.M{"_id": job.jobId},
+		h,
+		options.Replace().SetUpsert(true))
 	if err != nil {
-		job.logger.Error("Could not connect to mongo", zap.Error(err))
+		job.logger.Error("Could not save the history in the database",
+			zap.Error(err))
 		return
 	}
-	defer client.Disconnect(context.TODO())
 
-	// Create the history and index by id
-	collection := client.Database("kubeml").Collection("history")
-	h := api.History{
-		Id:   job.jobId,
-		Task: job.task.Parameters,
-		Data: job.history,
+	job.logger.Debug("Saved history", zap.String("status", status))
+}
+
+// historyClient returns the client used to save the history,
+// connecting it if it is the first time the history is saved
+func (job *TrainJob) historyClient() (*mongo.Client, error) {
+	job.mongoMu.Lock()
+	defer job.mongoMu.Unlock()
+
+	if job.mongoClient != nil {
+		return job.mongoClient, nil
 	}
 
-	// insert it in the DB
-	resp, err := collection.InsertOne(context.TODO(), h)
+	client, err := mongo.NewClient(options.Client().ApplyURI(createMongoURI()))
 	if err != nil {
-		job.logger.Error("Could not insert the history in the database",
-			zap.Error(err))
+		return nil, errors.Wrap(err, "could not create mongo client")
+	}
+
+	err = client.Connect(context.TODO())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to mongo")
+	}
+	job.mongoClient = client
+	return client, nil
+}
+
+// closeHistory disconnects the client used to save the history
+func (job *TrainJob) closeHistory() {
+	job.mongoMu.Lock()
+	defer job.mongoMu.Unlock()
+
+	if job.mongoClient != nil {
+		job.mongoClient.Disconnect(context.TODO())
 	}
+}
 
-	job.logger.Info("Inserted history", zap.Any("id", resp.InsertedID))
+// historyStatus returns the status of the history given
+// the phase in which the job finished
+func (job *TrainJob) historyStatus() string {
+	switch job.currentPhase() {
+	case api.PhaseSucceeded:
+		return api.StatusSucceeded
+	case api.PhaseStopped:
+		return api.StatusStopped
+	case api.PhaseFailed:
+		return api.StatusFailed
+	}
 
+	if job.exitErr != nil {
+		return api.StatusFailed
+	}
+	return api.StatusSucceeded
 }
@@ -0,0 +1,73 @@
+package train
+
+import (
+	"github.com/diegostock12/kubeml/ml/pkg/api"
+	"math"
+	"testing"
+)
+
+func TestAggregateMetrics(t *testing.T) {
+	results := []*FunctionResults{
+		{funcId: 0, results: map[string]float64{"loss": 1, "length": 30, "f1": 0.2, "errors": 3}},
+		{funcId: 1, results: map[string]float64{"loss": 2, "length": 10, "f1": 0.6, "errors": 5}},
+	}
+
+	tests := []struct {
+		name    string
+		results []*FunctionResults
+		rules   map[string]string
+		want    map[string]float64
+	}{
+		{
+			name:    "weighted by length",
+			results: results,
+			want:    map[string]float64{"f1": 0.3, "errors": 3.5},
+		},
+		{
+			name:    "rules",
+			results: results,
+			rules:   map[string]string{"f1": api.AggregationMean, "errors": api.AggregationSum},
+			want:    map[string]float64{"f1": 0.4, "errors": 8},
+		},
+		{
+			name:    "max",
+			results: results,
+			rules:   map[string]string{"f1": api.AggregationMax, "errors": api.AggregationMax},
+			want:    map[string]float64{"f1": 0.6, "errors": 5},
+		},
+		{
+			name: "missing length",
+			results: []*FunctionResults{
+				{results: map[string]float64{"f1": 0.2}},
+				{results: map[string]float64{"f1": 0.6, "length": 0}},
+			},
+			want: map[string]float64{"f1": 0.4},
+		},
+		{
+			name: "metric of some functions",
+			results: []*FunctionResults{
+				{results: map[string]float64{"length": 10, "f1": 0.2}},
+				{results: map[string]float64{"length": 10}},
+			},
+			want: map[string]float64{"f1": 0.2},
+		},
+		{
+			name: "no results",
+			want: map[string]float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregateMetrics(tt.results, tt.rules)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got metrics %v, want %v", got, tt.want)
+			}
+			for name, value := range tt.want {
+				if math.Abs(got[name]-value) > 1e-9 {
+					t.Errorf("got %v=%v, want %v", name, got[name], value)
+				}
+			}
+		})
+	}
+}
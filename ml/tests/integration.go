@@ -27,7 +27,7 @@ func main() {
 	// Create the scheduler which will trigger the parameter server for now
 	// The paramater server will also fetch the layers from the redis db and build a model
 	go controller.Start(logger, api.ControllerPortDebug, schedulerUrl, psUrl)
-	go scheduler.Start(logger, api.SchedulerPortDebug, psUrl)
+	go scheduler.Start(logger, api.SchedulerPortDebug, psUrl, scheduler.Options{})
 	go ps.Start(logger, api.ParameterServerPortDebug, schedulerUrl, false)
 
 	select {}
@@ -1,5 +1,6 @@
 import pickle
 from abc import ABC, abstractmethod
+from typing import List, Sequence
 
 import numpy as np
 import torch.utils.data as data
@@ -34,6 +35,12 @@ class _KubeArgs:
                  epoch: int,
                  lr: float = 0,
                  batch_size: int = 0,
+                 folds: int = 0,
+                 fold: int = 0,
+                 seed: int = None,
+                 shards: List[range] = None,
+                 fraction: float = 0,
+                 sample: int = 0,
                  ):
         """
         :arg job_id: id of the job\n
@@ -43,6 +50,12 @@ class _KubeArgs:
         :arg func_id: id of the function
         :arg lr: learning rate
         :arg batch_size: size of the batch
+        :arg folds: number of folds in cross validation runs
+        :arg fold: fold held out for validation
+        :arg seed: seed of the invocation in reproducible trainings
+        :arg shards: ranges of documents of the train set assigned to the function
+        :arg fraction: fraction of the test set used in the validation
+        :arg sample: id of the sample of the test set, the same for all the functions of a validation
         """
 
         self._job_id = job_id
@@ -53,6 +66,12 @@ class _KubeArgs:
         self.lr = lr
         self.batch_size = batch_size
         self.epoch = epoch
+        self.folds = folds
+        self.fold = fold
+        self.seed = seed
+        self.shards = shards
+        self.fraction = fraction
+        self.sample = sample
 
     @classmethod
     def parse(cls):
@@ -69,12 +88,18 @@ class _KubeArgs:
             lr = request.args.get("lr", type=float)
             batch_size = request.args.get("batchSize", type=int)
             epoch = request.args.get("epoch", type=int)
+            folds = request.args.get("folds", default=0, type=int)
+            fold = request.args.get("fold", default=0, type=int)
+            seed = request.args.get("seed", type=int)
+            shards = request.args.get("shard", type=parse_shards)
+            fraction = request.args.get("fraction", default=0, type=float)
+            sample = request.args.get("sample", default=0, type=int)
 
         except ValueError as ve:
             logging.error(f"Error parsing request arguments: {ve}, args:{request.args}")
             raise InvalidArgsError(ve)
 
-        args = cls(job_id, N, K, task, func_id, epoch, lr, batch_size)
+        args = cls(job_id, N, K, task, func_id, epoch, lr, batch_size, folds, fold, seed, shards, fraction, sample)
         return args
 
 
@@ -125,6 +150,26 @@ class KubeDataset(data.Dataset, ABC):
         self.num_val_docs = self._database["test"].count_documents({})
         logging.debug(f"Num docs: {self.num_docs}, Num val docs: {self.num_val_docs}")
 
+        # in cross validation runs, the subsets of the train set held out for validation
+        self._fold = None
+        self._total_docs = self.num_docs
+
+    def _set_fold(self, folds: int, fold: int):
+        """
+        Holds out one of the folds of the train set for validation. The train task then uses
+        the rest of the train set and the validation task uses the fold instead of the test set
+
+        :param folds: number of folds, if lower than 2 the dataset is not split
+        :param fold: index of the fold held out
+        """
+        if folds < 2:
+            return
+
+        self._fold = split_minibatches(range(self._total_docs), folds)[fold]
+        self.num_docs = self._total_docs - len(self._fold)
+        self.num_val_docs = len(self._fold)
+        logging.debug(f"Holding out fold {fold} of {folds}, subsets {self._fold}")
+
     def _eval(self):
         """
         Sets the dataset in eval mode
@@ -147,7 +192,7 @@ class KubeDataset(data.Dataset, ABC):
         """
         return self._mode == 'train'
 
-    def _load_train_data(self, start: int, end: int):
+    def _load_train_data(self, start: int = 0, end: int = 0, subsets: Sequence[int] = None):
         """
         For K averaging the data needs to be refreshed with the next K batches
         after every synchronization step, this is triggered by the KubeModel before
@@ -155,23 +200,25 @@ class KubeDataset(data.Dataset, ABC):
 
         :param start: first subset to be loaded
         :param end: last subset to be loaded
+        :param subsets: ids of the subsets to be loaded, used instead of the range if given
         """
         # load the minibatches given by the network
-        minibatches = range(start, end)
+        minibatches = subsets if subsets is not None else range(start, end)
         logging.debug(f"Loading minibatches {minibatches}")
         self.data, self.labels = self.__load_data(minibatches)
 
         # put the dataset in train mode
         self._train()
 
-    def _load_validation_data(self, start: int, end: int):
+    def _load_validation_data(self, start: int = 0, end: int = 0, subsets: Sequence[int] = None):
         """
         Loads the validation data given the subsets assigned to this functions
 
         :param start: first subset to be loaded
         :param end: last subset to be loaded
+        :param subsets: ids of the subsets to be loaded, used instead of the range if given
         """
-        minibatches = range(start, end)
+        minibatches = subsets if subsets is not None else range(start, end)
         logging.debug(f"Loading minibatches {minibatches}")
         self.data, self.labels = self.__load_data(minibatches, validation=True)
 
@@ -181,7 +228,7 @@ class KubeDataset(data.Dataset, ABC):
     def _close(self):
         self._client.close()
 
-    def __load_data(self, minibatches: range, validation=False):
+    def __load_data(self, minibatches: Sequence[int], validation=False):
         """
         Load the data needed to perform the train or validation tasks.
 
@@ -196,11 +243,23 @@ class KubeDataset(data.Dataset, ABC):
         try:
             # based on the validation flag load the data from a different collection
             collection = 'test' if validation else 'train'
-            batches = self._database[collection].find({
-                '_id': {
-                    '$gte': minibatches.start,
-                    '$lte': minibatches.stop - 1}
-            })
+            if isinstance(minibatches, range):
+                query = {'_id': {'$gte': minibatches.start, '$lte': minibatches.stop - 1}}
+            else:
+                query = {'_id': {'$in': list(minibatches)}}
+
+            # with a fold held out, the validation data is the fold and the
+            # train data the subsets of the train set before and after it
+            if self._fold is not None:
+                collection = 'train'
+                offset = len(self._fold)
+                if validation:
+                    query = {'_id': {'$in': [self._fold.start + i for i in minibatches]}}
+                else:
+                    ids = [i if i < self._fold.start else i + offset for i in minibatches]
+                    query = {'_id': {'$in': ids}}
+
+            batches = self._database[collection].find(query)
         except PyMongoError as e:
             self._client.close()
             raise StorageError(e)
@@ -1,10 +1,11 @@
 from abc import ABC
-from collections import defaultdict
+from collections import defaultdict, Counter
 from typing import Dict, Tuple, Any, Union, Callable, Iterable, Sequence
 
 import flask
 import numpy as np
 import pickle
+import random
 import redisai as rai
 import requests
 from flask import request, jsonify, current_app
@@ -95,6 +96,23 @@ class KubeModel(ABC):
         self.batch_size = self.args.batch_size
         self.task = self.args._task
         self.epoch = self.args.epoch
+        self._dataset._set_fold(self.args.folds, self.args.fold)
+        if self.args.seed is not None:
+            self._seed(self.args.seed)
+
+    @staticmethod
+    def _seed(seed: int):
+        """
+        Seeds the random generators used by the function so the
+        results are the same in every run with the same seed
+
+        :param seed: seed given by the train job for this invocation
+        """
+        random.seed(seed)
+        np.random.seed(seed)
+        torch.manual_seed(seed)
+        torch.backends.cudnn.deterministic = True
+        torch.backends.cudnn.benchmark = False
 
     def _config_optimizer(self):
         """
@@ -156,12 +174,16 @@ class KubeModel(ABC):
             return jsonify(layers), 200
 
         elif self.task == "train":
-            loss = self.__train()
-            return jsonify(loss=loss), 200
+            loss, length, metrics = self.__train()
+            return jsonify(loss=loss, length=length, **metrics), 200
 
         elif self.task == "val":
-            acc, loss, length = self.__validate()
-            return jsonify(loss=loss, accuracy=acc, length=length), 200
+            acc, loss, length, metrics = self.__validate()
+            return jsonify(loss=loss, accuracy=acc, length=length, **metrics), 200
+
+        elif self.task == "eval":
+            length, confusion = self.__evaluate()
+            return jsonify(length=length, confusion=confusion), 200
 
         elif self.task == "infer":
             preds = self.__infer()
@@ -249,19 +271,38 @@ class KubeModel(ABC):
         else:
             return batch
 
-    def __train(self) -> float:
+    @staticmethod
+    def __accumulate_metrics(total: Dict[str, float], metrics: Dict[str, float]):
+        """
+        Adds the custom metrics returned by the user for a batch to the running totals.
+        The reserved names used by kubeml (loss, accuracy and length) are ignored
+
+        :param total: the running totals of the metrics
+        :param metrics: the metrics returned for the batch
+        """
+        for name, value in metrics.items():
+            if name in ('loss', 'accuracy', 'length'):
+                continue
+            total[name] = total.get(name, 0) + float(value)
+
+    def __train(self) -> Tuple[float, int, Dict[str, float]]:
         """
         Function called to train the network. Loads the reference model from the database,
         trains with the method provided by the user and saves the model after training to the database
 
-        :return: The loss of the epoch, as returned by the user function
+        :return: The loss of the epoch, as returned by the user function, the number of datapoints
+        and the average of the custom metrics returned by the user
         """
 
         self._on_train_start()
 
-        # Determine the batches that we need to train on and the first subset id
-        assigned_subsets = split_minibatches(range(self._dataset.num_docs),
-                                             self.args._N)[self.args._func_id]
+        # Determine the batches that we need to train on, the shards sent by
+        # the train job or, if not given, the ones corresponding to the function id
+        if self.args.shards is not None:
+            assigned_subsets = [i for shard in self.args.shards for i in shard]
+        else:
+            assigned_subsets = split_minibatches(range(self._dataset.num_docs),
+                                                 self.args._N)[self.args._func_id]
 
         # calculate the number of subsets that we need to train on
         # per epoch
@@ -269,20 +310,26 @@ class KubeModel(ABC):
                                              self.args.batch_size,
                                              assigned_subsets)
         self.logger.debug(f"Subsets per iteration: {subsets_per_iter}")
-        intervals = range(assigned_subsets.start, assigned_subsets.stop, subsets_per_iter)
+        intervals = range(0, len(assigned_subsets), subsets_per_iter)
 
         # the loss will be added cross intervals, each interval will have one loader, whose length
         # will determine the number of losses added.
         loss = 0
         num_iterations = 0
+        num_samples = 0
+        metrics = {}
         for i in intervals:
 
             self.logger.debug(f"Starting iteration {i}")
-            self._dataset._load_train_data(start=i, end=min(assigned_subsets.stop, i + subsets_per_iter))
+            self._dataset._load_train_data(subsets=assigned_subsets[i:i + subsets_per_iter])
 
             # create the loader that will be used
             loader = DataLoader(self._dataset, batch_size=self.batch_size)
             num_iterations += len(loader)
+            num_samples += len(self._dataset)
+
+            # running loss of the interval, reported to the train job when syncing
+            interval_loss = 0
 
             # load the reference model, train and save
             try:
@@ -291,8 +338,15 @@ class KubeModel(ABC):
                 for idx, batch in enumerate(loader):
                     # send the batch to the appropriate device
                     batch = self._batch_to_device(batch)
-                    loss += self.train(batch, idx)
-                    self.logger.debug(f'loss is {loss}, iterations are {num_iterations}')
+                    result = self.train(batch, idx)
+
+                    # the user might return a dict with custom metrics with the loss
+                    if isinstance(result, tuple):
+                        result, batch_metrics = result
+                        self.__accumulate_metrics(metrics, batch_metrics)
+
+                    interval_loss += result
+                    self.logger.debug(f'loss is {loss + interval_loss}, iterations are {num_iterations}')
 
                 self._on_iteration_end()
             except RedisError as re:
@@ -300,14 +354,16 @@ class KubeModel(ABC):
             finally:
                 self._redis_client.close()
 
+            loss += interval_loss
+
             # send notification to the train job to refresh the model if not
             # the last interval
             if i != intervals[-1]:
-                self.__send_finish_signal()
+                self.__send_finish_signal(interval_loss / max(len(loader), 1), len(self._dataset))
 
         self._on_train_end()
 
-        return loss / num_iterations
+        return loss / num_iterations, num_samples, {k: v / num_iterations for k, v in metrics.items()}
 
     def _on_validation_start(self):
         """
@@ -325,29 +381,42 @@ class KubeModel(ABC):
         - Creates a data loader
         - Feeds the validate function defined by the user with datapoints already sent to the correct device
 
-        :return: A tuple containing the mean accuracy and loss on the val dataset and the number or datapoints
+        :return: A tuple containing the mean accuracy and loss on the val dataset, the number or datapoints
+        and the average of the custom metrics returned by the user
         """
 
         self._on_validation_start()
 
         # Determine the batches that we need to validate on and the first
-        # subset id that we need to get each iteration
-        assigned_subsets = split_minibatches(range(self._dataset.num_val_docs), self.args._N)[self.args._func_id]
+        # subset id that we need to get each iteration. If only a fraction of the
+        # test set is validated, all functions take the same random sample and split it
+        docs = range(self._dataset.num_val_docs)
+        if 0 < self.args.fraction < 1:
+            size = max(1, round(len(docs) * self.args.fraction))
+            rng = random.Random(f'{self.args._job_id}/{self.args.sample}')
+            docs = sorted(rng.sample(docs, size))
+
+        assigned_subsets = split_minibatches(range(len(docs)), self.args._N)[self.args._func_id]
 
         # load the validation data
-        self._dataset._load_validation_data(start=assigned_subsets.start,
-                                            end=assigned_subsets.stop)
+        self._dataset._load_validation_data(subsets=docs[assigned_subsets.start:assigned_subsets.stop])
 
         # create the loader that will be used
         loader = DataLoader(self._dataset, batch_size=self.batch_size)
 
         acc, loss = 0, 0
+        metrics = {}
         try:
             self.__load_model()
             with torch.no_grad():
                 for idx, batch in enumerate(loader):
                     batch = self._batch_to_device(batch)
-                    _acc, _loss = self.validate(batch, idx)
+                    result = self.validate(batch, idx)
+
+                    # the user might return a dict with custom metrics as a third element
+                    if len(result) > 2:
+                        self.__accumulate_metrics(metrics, result[2])
+                    _acc, _loss = result[0], result[1]
 
                     # accumulate statistics
                     acc += _acc
@@ -357,7 +426,41 @@ class KubeModel(ABC):
         finally:
             self._redis_client.close()
 
-        return acc / len(loader), loss / len(loader), len(self._dataset)
+        metrics = {k: v / len(loader) for k, v in metrics.items()}
+        return acc / len(loader), loss / len(loader), len(self._dataset), metrics
+
+    def __evaluate(self) -> Tuple[int, List[List[int]]]:
+        """
+        Evaluate runs the final model on the part of the test set assigned to the
+        function and counts the samples of each pair of true and predicted class,
+        which the parameter server merges in a confusion matrix
+
+        :return: the number of datapoints and a list of (true class, predicted class, count) triples
+        """
+
+        self._on_validation_start()
+
+        assigned_subsets = split_minibatches(range(self._dataset.num_val_docs), self.args._N)[self.args._func_id]
+        self._dataset._load_validation_data(start=assigned_subsets.start,
+                                            end=assigned_subsets.stop)
+        loader = DataLoader(self._dataset, batch_size=self.batch_size)
+
+        counts = Counter()
+        try:
+            self.__load_model()
+            with torch.no_grad():
+                for idx, batch in enumerate(loader):
+                    batch = self._batch_to_device(batch)
+                    preds, targets = self.evaluate(batch, idx)
+                    preds = torch.as_tensor(preds).view(-1).tolist()
+                    targets = torch.as_tensor(targets).view(-1).tolist()
+                    counts.update(zip(map(int, targets), map(int, preds)))
+        except RedisError as re:
+            raise StorageError(re)
+        finally:
+            self._redis_client.close()
+
+        return len(self._dataset), [[t, p, c] for (t, p), c in counts.items()]
 
     def __infer(self) -> Union[torch.Tensor, np.ndarray, List[float]]:
         data_json = request.json
@@ -392,11 +495,14 @@ class KubeModel(ABC):
             self._network = self._network.to(self.device)
             self.logger.debug(f'Set device to {self.device}')
 
-    def __send_finish_signal(self):
+    def __send_finish_signal(self, loss: float, samples: int):
         """Sends a request to the train job communicating that the iteration is over
         and the model is published in the database.
 
         The PS will not respond until all the functions have finished the step
+
+        :param loss: running loss of the iteration
+        :param samples: number of datapoints used in the iteration
         """
 
         # create the url for the job service
@@ -404,7 +510,7 @@ class KubeModel(ABC):
 
         try:
             self.logger.debug(f"Sending request to {url}")
-            resp = requests.post(url)
+            resp = requests.post(url, json={'loss': loss, 'samples': samples})
         except requests.ConnectionError as e:
             self.logger.error("error connecting to the train job")
             raise MergeError(e)
@@ -466,11 +572,20 @@ class KubeModel(ABC):
     def init(self):
         pass
 
-    def train(self, batch, batch_index: int) -> float:
+    def train(self, batch, batch_index: int) -> Union[float, Tuple[float, Dict[str, float]]]:
         pass
 
-    def validate(self, batch, batch_index: int) -> Tuple[float, float]:
+    def validate(self, batch, batch_index: int) -> Union[Tuple[float, float], Tuple[float, float, Dict[str, float]]]:
         pass
 
     def infer(self, data: List[Any]) -> Union[torch.Tensor, np.ndarray, List[float]]:
         pass
+
+    def evaluate(self, batch, batch_index: int) -> Tuple[Any, Any]:
+        """
+        Returns the predicted and the true classes of the samples of the batch,
+        used to build the per-class report of the final evaluation.
+        By default the class with the highest output of the network is predicted
+        """
+        x, y = batch
+        return self._network(x).argmax(dim=1), y
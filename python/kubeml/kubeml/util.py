@@ -56,6 +56,21 @@ def split_minibatches(a: range, n: int) -> List[range]:
     return [a[i * k + min(i, m):(i + 1) * k + min(i + 1, m)] for i in range(n)]
 
 
+def parse_shards(shards: str) -> List[range]:
+    """
+    Parses the shards assigned to the function by the train job, sent
+    as a list of ranges of documents start:end separated by commas
+
+    :arg shards the string with the ranges
+    :return: list with the ranges of documents
+    """
+    ranges = []
+    for shard in shards.split(','):
+        start, end = shard.split(':')
+        ranges.append(range(int(start), int(end)))
+    return ranges
+
+
 def get_subset_period(K: int, batch_size: int, assigned_subsets: range) -> int:
     """
     Calculates the number of subsets that will be evaluated per iteration